@@ -1,10 +1,38 @@
 package app
 
-import "github.com/agidelle/TODO_web_v2/internal/api"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/api"
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/agidelle/TODO_web_v2/internal/metrics"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+	"github.com/agidelle/TODO_web_v2/internal/storage"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+	"github.com/spf13/viper"
+)
+
+// totpIssuer отображается в приложении-аутентификаторе
+const totpIssuer string = "TODO"
 
 type App struct {
 	cfg      *Config
 	handlers *api.TaskHandler
+	keys     *jwks.KeySet
+	// metrics - обработчик для отдельного адреса TODO_METRICS_ADDR
+	metrics http.Handler
+	closeDB func()
 }
 
 type Config struct {
@@ -13,4 +41,200 @@ type Config struct {
 	DBPath   string `mapstructure:"TODO_DBFILE"`
 	Password string `mapstructure:"TODO_PASSWORD"`
 	JWTKey   string `mapstructure:"TODO_JWTSECRET"`
+	// JWTKeysDir - каталог с PEM-ключами RS256/ES256/EdDSA; если не задан, используется HS256 с TODO_JWTSECRET
+	JWTKeysDir   string `mapstructure:"TODO_JWT_KEYS_DIR"`
+	JWTActiveKID string `mapstructure:"TODO_JWT_ACTIVE_KID"`
+	// Размер страницы списка задач по умолчанию и максимальный
+	PageSize    int `mapstructure:"TODO_PAGE_SIZE"`
+	MaxPageSize int `mapstructure:"TODO_MAX_PAGE_SIZE"`
+	// LoginStore - где хранить счетчики попыток входа: memory или db
+	LoginStore string `mapstructure:"TODO_LOGIN_STORE"`
+	// Сколько хранить ответы на запросы с Idempotency-Key и где: memory или db
+	IdempotencyTTL   time.Duration `mapstructure:"TODO_IDEMPOTENCY_TTL"`
+	IdempotencyStore string        `mapstructure:"TODO_IDEMPOTENCY_STORE"`
+	// Lang - язык сообщений API по умолчанию: ru или en
+	Lang string `mapstructure:"TODO_LANG"`
+	// Только для тестовых стендов: DebugTime запускает сервер с остановленным
+	// (20240126 или RFC 3339) или сдвинутым (+72h) временем, DebugClockHeader
+	// разрешает задавать время отдельного запроса заголовком X-Debug-Now
+	DebugTime        string `mapstructure:"TODO_DEBUG_TIME"`
+	DebugClockHeader bool   `mapstructure:"TODO_DEBUG_CLOCK_HEADER"`
+	// Формат журнала (text или json) и минимальный уровень записей
+	LogFormat string `mapstructure:"TODO_LOG_FORMAT"`
+	LogLevel  string `mapstructure:"TODO_LOG_LEVEL"`
+	// Metrics включает маршрут GET /metrics для Prometheus. На основном порту
+	// он требует аутентификации; MetricsAddr (например, 127.0.0.1:9090)
+	// дополнительно открывает /metrics без нее на отдельном адресе.
+	Metrics     bool   `mapstructure:"TODO_METRICS"`
+	MetricsAddr string `mapstructure:"TODO_METRICS_ADDR"`
+	// Вход через OIDC включается, если задан TODO_OIDC_ISSUER
+	OIDCIssuer       string `mapstructure:"TODO_OIDC_ISSUER"`
+	OIDCClientID     string `mapstructure:"TODO_OIDC_CLIENT_ID"`
+	OIDCClientSecret string `mapstructure:"TODO_OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL  string `mapstructure:"TODO_OIDC_REDIRECT_URL"`
+	// OIDCAllowed - через запятую адреса почты или домены вида @example.com
+	OIDCAllowed string `mapstructure:"TODO_OIDC_ALLOWED"`
+}
+
+// LoadConfig читает конфигурацию из файла и переменных окружения
+func LoadConfig() (*Config, error) {
+	viper.SetDefault("TODO_PORT", 7540)
+	viper.SetDefault("TODO_LOGIN_STORE", "memory")
+	viper.SetDefault("TODO_LANG", "ru")
+	viper.SetDefault("TODO_LOG_FORMAT", "text")
+	viper.SetDefault("TODO_LOG_LEVEL", "info")
+	viper.SetDefault("TODO_METRICS", false)
+	viper.SetDefault("TODO_IDEMPOTENCY_TTL", "24h")
+	viper.SetDefault("TODO_IDEMPOTENCY_STORE", "memory")
+	viper.SetDefault("TODO_PAGE_SIZE", 25)
+	viper.SetDefault("TODO_MAX_PAGE_SIZE", 100)
+	// Без явной привязки viper.Unmarshal не видит переменные окружения
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("mapstructure"); key != "" {
+			if err := viper.BindEnv(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func New(ctx context.Context, cfg *Config) (*App, error) {
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+
+	keys, err := loadKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lang, ok := i18n.Parse(cfg.Lang)
+	if !ok {
+		return nil, fmt.Errorf("неподдерживаемый язык TODO_LANG: %q", cfg.Lang)
+	}
+
+	clock, err := service.ParseClock(cfg.DebugTime, service.SystemClock)
+	if err != nil {
+		return nil, fmt.Errorf("некорректное значение TODO_DEBUG_TIME %q: %w", cfg.DebugTime, err)
+	}
+	if cfg.DebugTime != "" {
+		logger.Warn("Время сервера подменено настройкой TODO_DEBUG_TIME", "value", cfg.DebugTime)
+	}
+
+	repo, err := storage.NewPool(ctx, cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	serviceOpts := []service.ServiceOption{
+		service.WithPageSize(cfg.PageSize, cfg.MaxPageSize),
+		service.WithClock(clock),
+	}
+	var m *metrics.Metrics
+	if cfg.Metrics {
+		m = metrics.New()
+		if err = m.Register(metrics.NewPoolCollector(repo.Stat)); err != nil {
+			repo.CloseDB()
+			return nil, err
+		}
+		serviceOpts = append(serviceOpts, service.WithMetrics(m))
+	}
+	taskService := service.NewService(repo, serviceOpts...)
+
+	var loginStore domain.LoginAttemptStore = memory.NewLoginStore()
+	if cfg.LoginStore == "db" {
+		loginStore = repo
+	}
+	var idempotencyStore domain.IdempotencyStore = memory.NewIdempotencyStore()
+	if cfg.IdempotencyStore == "db" {
+		idempotencyStore = repo
+	}
+
+	opts := []api.HandlerOption{
+		api.WithLogger(logger),
+		api.WithLanguage(lang),
+		api.WithDebugClock(cfg.DebugClockHeader),
+		api.WithTokens(service.NewTokenService(repo)),
+		api.WithLoginGuard(service.NewLoginGuard(loginStore)),
+		api.WithTwoFactor(service.NewTwoFactorService(repo, totpIssuer)),
+		api.WithSavedFilters(service.NewSavedFilterService(repo, taskService)),
+		api.WithIdempotency(service.NewIdempotency(idempotencyStore, cfg.IdempotencyTTL)),
+	}
+	if m != nil {
+		opts = append(opts, api.WithMetrics(m))
+	}
+	if cfg.OIDCIssuer != "" {
+		opts = append(opts, api.WithOIDC(service.NewOIDCService(service.OIDCConfig{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Allowed:      strings.Split(cfg.OIDCAllowed, ","),
+			Account:      api.DefaultAccount,
+		}, repo)))
+	}
+
+	handlers := api.NewHandler(taskService, opts...)
+	a := &App{cfg: cfg, handlers: handlers, keys: keys, closeDB: repo.CloseDB}
+	if m != nil && cfg.MetricsAddr != "" {
+		a.metrics = m.Handler()
+	}
+	return a, nil
+}
+
+func loadKeys(cfg *Config) (*jwks.KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		return jwks.NewHMACKeySet(cfg.JWTKey)
+	}
+	return jwks.LoadKeySet(cfg.JWTKeysDir, cfg.JWTActiveKID, cfg.JWTKey)
+}
+
+// Run запускает HTTP-сервер и корректно останавливает его при отмене ctx
+func (a *App) Run(ctx context.Context) error {
+	defer a.closeDB()
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", a.cfg.Port),
+		Handler: a.handlers.Router(a.cfg.Password, a.keys),
+	}
+
+	servers := []*http.Server{srv}
+	if a.metrics != nil {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", a.metrics)
+		servers = append(servers, &http.Server{Addr: a.cfg.MetricsAddr, Handler: mux})
+	}
+
+	errCh := make(chan error, len(servers))
+	for _, s := range servers {
+		go func() {
+			slog.Info("Server started", "addr", s.Addr)
+			errCh <- s.ListenAndServe()
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
 }
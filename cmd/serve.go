@@ -5,26 +5,45 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"fmt"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/agidelle/TODO_web_v2/app"
 	"github.com/spf13/cobra"
 )
 
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
 	Use:   "serve",
-	Short: "A brief description of your command",
-	Long: `A longer description that spans multiple lines and likely contains examples
-and usage of using your command. For example:
-
-Cobra is a CLI library for Go that empowers applications.
-This application is a tool to generate the needed files
-to quickly create a Cobra application.`,
+	Short: "Start the TODO HTTP server",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("serve called")
+		cfg, err := app.LoadConfig()
+		if err != nil {
+			fatal("Unable to load config", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		application, err := app.New(ctx, cfg)
+		if err != nil {
+			fatal("Unable to start application", err)
+		}
+		if err = application.Run(ctx); err != nil {
+			fatal("Server error", err)
+		}
 	},
 }
 
+// fatal пишет ошибку в журнал и завершает процесс
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 
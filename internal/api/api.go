@@ -3,71 +3,154 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
 	"github.com/agidelle/TODO_web_v2/internal/service"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-var errorMap = map[error]int{
-	domain.ErrID:             http.StatusBadRequest,
-	domain.ErrBadTitle:       http.StatusBadRequest,
-	domain.ErrDate:           http.StatusBadRequest,
-	domain.ErrInternalServer: http.StatusInternalServerError,
-}
-
 const dateForm string = "20060102"
 
 type TaskHandler struct {
-	service TaskService
+	service     TaskService
+	tokens      TokenService
+	loginGuard  LoginGuard
+	twoFactor   TwoFactorService
+	oidc        OIDCService
+	filters     SavedFilterService
+	idempotency IdempotencyService
+	lang        i18n.Lang
+	debugClock  bool
+	logger      *slog.Logger
+	metrics     Metrics
 }
 
+type HandlerOption func(*TaskHandler)
+
 type TaskService interface {
 	FindAll(ctx context.Context, filter *domain.Filter) ([]*domain.Task, *domain.CustomError)
+	FindPage(ctx context.Context, filter *domain.Filter) (*domain.TaskPage, *domain.CustomError)
 	Create(ctx context.Context, task *domain.Task) (int64, *domain.CustomError)
 	Update(ctx context.Context, task *domain.Task) *domain.CustomError
-	Done(ctx context.Context, filter *domain.Filter) *domain.CustomError
-	Delete(ctx context.Context, id int) *domain.CustomError
+	Patch(ctx context.Context, id int, input *domain.TaskInput, version int64) (*domain.Task, *domain.CustomError)
+	Done(ctx context.Context, filter *domain.Filter, version int64) (*domain.Task, *domain.CustomError)
+	Delete(ctx context.Context, id int, version int64) *domain.CustomError
+	Batch(ctx context.Context, ops []domain.BatchOp, atomic bool) ([]domain.BatchResult, bool, *domain.CustomError)
+	QuickAdd(ctx context.Context, text string) (*domain.Task, *domain.CustomError)
+	QuickAddPreview(ctx context.Context, text string) (*domain.Task, *domain.CustomError)
 	NextDate(now time.Time, dstart string, repeat string) (string, error)
+	Now(ctx context.Context) time.Time
+	Clock() service.Clock
+	RepeatPreview(ctx context.Context, repeat, start string, count int) (*domain.RepeatRule, []string, *domain.CustomError)
 	CloseDB()
 }
 
-func NewHandler(service *service.TaskService) *TaskHandler {
-	return &TaskHandler{service: service}
+type TokenService interface {
+	Create(ctx context.Context, name string, scopes []domain.Scope, ttl time.Duration) (string, *domain.APIToken, *domain.CustomError)
+	List(ctx context.Context) ([]*domain.APIToken, *domain.CustomError)
+	Revoke(ctx context.Context, id int64) *domain.CustomError
+	Authenticate(ctx context.Context, raw string) (*domain.APIToken, *domain.CustomError)
 }
 
-func sendJSONError(w http.ResponseWriter, customErr *domain.CustomError) {
-	w.WriteHeader(customErr.Code)
-	var errorMessage string
-	if customErr.ErrStorage != nil {
-		errorMessage = fmt.Sprintf("%v: %v", customErr.Err, customErr.ErrStorage)
-	} else {
-		errorMessage = fmt.Sprintf("%v", customErr.Err)
+type LoginGuard interface {
+	Check(ctx context.Context, ip, account string) (time.Duration, *domain.CustomError)
+	Fail(ctx context.Context, ip, account string) (time.Duration, *domain.CustomError)
+	Succeed(ctx context.Context, ip, account string) *domain.CustomError
+}
+
+type TwoFactorService interface {
+	Enroll(ctx context.Context, account string) (*domain.Enrollment, *domain.CustomError)
+	Confirm(ctx context.Context, account, code string) *domain.CustomError
+	Disable(ctx context.Context, account, code string) *domain.CustomError
+	Enabled(ctx context.Context, account string) (bool, *domain.CustomError)
+	Verify(ctx context.Context, account, code string) *domain.CustomError
+	Redeem(ctx context.Context, account, recoveryCode string) *domain.CustomError
+}
+
+func NewHandler(service *service.TaskService, opts ...HandlerOption) *TaskHandler {
+	h := &TaskHandler{service: service, lang: i18n.Default}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
+}
 
-	err := json.NewEncoder(w).Encode(struct {
-		Error string `json:"error"`
-	}{
-		Error: errorMessage,
-	})
-	if err != nil {
-		log.Println(err)
+// WithTokens включает аутентификацию по персональным API-токенам
+func WithTokens(tokens TokenService) HandlerOption {
+	return func(h *TaskHandler) {
+		h.tokens = tokens
+	}
+}
+
+// WithLoginGuard включает защиту входа от перебора паролей
+func WithLoginGuard(guard LoginGuard) HandlerOption {
+	return func(h *TaskHandler) {
+		h.loginGuard = guard
+	}
+}
+
+// WithTwoFactor включает второй шаг входа по коду TOTP
+func WithTwoFactor(twoFactor TwoFactorService) HandlerOption {
+	return func(h *TaskHandler) {
+		h.twoFactor = twoFactor
+	}
+}
+
+// WithSavedFilters включает сохраненные фильтры
+func WithSavedFilters(filters SavedFilterService) HandlerOption {
+	return func(h *TaskHandler) {
+		h.filters = filters
+	}
+}
+
+// WithIdempotency включает поддержку заголовка Idempotency-Key у изменяющих запросов
+func WithIdempotency(idempotency IdempotencyService) HandlerOption {
+	return func(h *TaskHandler) {
+		h.idempotency = idempotency
+	}
+}
+
+// WithLanguage задает язык сообщений, если клиент не выбрал поддерживаемый
+func WithLanguage(lang i18n.Lang) HandlerOption {
+	return func(h *TaskHandler) {
+		h.lang = lang
+	}
+}
+
+// WithOIDC включает вход через OpenID Connect наряду с паролем
+func WithOIDC(oidc OIDCService) HandlerOption {
+	return func(h *TaskHandler) {
+		h.oidc = oidc
+	}
+}
+
+// errorStatusV1 - статус ошибки в v1: отсутствующая задача исторически
+// дает 400, в v2 - 404
+func errorStatusV1(cErr *domain.CustomError) int {
+	if cErr.Code == 0 && cErr.Err == domain.ErrNotFound {
+		return http.StatusBadRequest
 	}
+	return errorStatus(cErr)
 }
 
-func sendJSONTasks(w http.ResponseWriter, tasks []*domain.Task) {
+func sendJSONError(w http.ResponseWriter, r *http.Request, customErr *domain.CustomError) {
+	status := errorStatusV1(customErr)
+	logProblem(r, customErr, status)
+	p := newProblem(customErr, status, i18n.FromContext(r.Context()))
+	p.Error = p.Detail
+	writeProblem(w, r, p)
+}
+
+func sendJSONTasks(w http.ResponseWriter, r *http.Request, page *domain.TaskPage) {
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(struct {
-		Tasks []*domain.Task `json:"tasks"`
-	}{
-		Tasks: tasks,
-	})
+	err := json.NewEncoder(w).Encode(page)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 	}
 }
 
@@ -78,19 +161,14 @@ func (h *TaskHandler) AddTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	var task domain.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, errors.New("ошибка десериализации JSON"), nil))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, nil))
 		return
 	}
 
 	//Добавление задачи
 	id, cErr := h.service.Create(ctx, &task)
 	if cErr != nil {
-		if code, ok := errorMap[cErr.Err]; ok {
-			cErr.Code = code
-		} else {
-			cErr.Code = http.StatusInternalServerError
-		}
-		sendJSONError(w, cErr)
+		sendJSONError(w, r, cErr)
 		return
 	}
 
@@ -99,7 +177,7 @@ func (h *TaskHandler) AddTask(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	err := json.NewEncoder(w).Encode(map[string]int64{"id": id})
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 	}
 }
 
@@ -107,37 +185,46 @@ func (h *TaskHandler) GetTasks(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	var filter domain.Filter
-	queryValues := r.URL.Query()
-	_, searchParamExists := queryValues["search"]
-
-	filter.SearchTerm = r.URL.Query().Get("search")
-
-	if !searchParamExists {
-		res, cErr := h.service.FindAll(ctx, &filter)
-		if cErr != nil {
-			if code, ok := errorMap[cErr.Err]; ok {
-				cErr.Code = code
-			} else {
-				cErr.Code = http.StatusInternalServerError
-			}
-			sendJSONError(w, cErr)
-			return
+	filter, cErr := listFilter(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	page, cErr := h.service.FindPage(ctx, filter)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	sendJSONTasks(w, r, page)
+}
+
+// listFilter разбирает параметры списка задач: search, from, to, period,
+// norepeat, sort, limit и cursor
+func listFilter(r *http.Request) (*domain.Filter, *domain.CustomError) {
+	query := r.URL.Query()
+	filter := &domain.Filter{
+		SearchTerm: query.Get("search"),
+		From:       query.Get("from"),
+		To:         query.Get("to"),
+		Period:     query.Get("period"),
+		Sort:       domain.Sort(query.Get("sort")),
+		Cursor:     query.Get("cursor"),
+	}
+	if noRepeat := query.Get("norepeat"); noRepeat != "" {
+		b, err := strconv.ParseBool(noRepeat)
+		if err != nil {
+			return nil, domain.NewCustomError(0, domain.ErrParam, fmt.Errorf("norepeat: %w", err))
 		}
-		sendJSONTasks(w, res)
-	} else {
-		res, cErr := h.service.FindAll(ctx, &filter)
-		if cErr != nil {
-			if code, ok := errorMap[cErr.Err]; ok {
-				cErr.Code = code
-			} else {
-				cErr.Code = http.StatusInternalServerError
-			}
-			sendJSONError(w, cErr)
-			return
+		filter.NoRepeat = b
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return nil, domain.NewCustomError(0, domain.ErrLimit, err)
 		}
-		sendJSONTasks(w, res)
+		filter.Limit = n
 	}
+	return filter, nil
 }
 
 func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
@@ -147,30 +234,26 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	var filter domain.Filter
 	searchID := r.URL.Query().Get("id")
 	if searchID == "" {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, domain.ErrID, nil))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, nil))
 		return
 	}
 	id, err := strconv.Atoi(searchID)
 	if err != nil {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, domain.ErrID, err))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, err))
 		return
 	}
 	filter.ID = &id
 	task, cErr := h.service.FindAll(ctx, &filter)
 	if cErr != nil {
-		if code, ok := errorMap[cErr.Err]; ok {
-			cErr.Code = code
-		} else {
-			cErr.Code = http.StatusInternalServerError
-		}
-		sendJSONError(w, cErr)
+		sendJSONError(w, r, cErr)
 		return
 	}
 
 	task[0].ID = searchID
+	setETag(w, task[0])
 	err = json.NewEncoder(w).Encode(&task)
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 	}
 }
 
@@ -181,22 +264,23 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	var task domain.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, errors.New("ошибка десериализации JSON"), err))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, err))
 		return
 	}
-	cErr := h.service.Update(ctx, &task)
+	version, cErr := ifMatchV1(r)
 	if cErr != nil {
-		if code, ok := errorMap[cErr.Err]; ok {
-			cErr.Code = code
-		} else {
-			cErr.Code = http.StatusInternalServerError
-		}
-		sendJSONError(w, cErr)
+		sendJSONError(w, r, cErr)
+		return
+	}
+	task.Version = version
+	cErr = h.service.Update(ctx, &task)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
 		return
 	}
 	err := json.NewEncoder(w).Encode(domain.Task{})
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 	}
 }
 
@@ -207,29 +291,29 @@ func (h *TaskHandler) Done(w http.ResponseWriter, r *http.Request) {
 	var filter domain.Filter
 	searchID := r.URL.Query().Get("id")
 	if searchID == "" {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, domain.ErrID, nil))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, nil))
 		return
 	}
 	id, err := strconv.Atoi(searchID)
 	if err != nil {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, domain.ErrID, err))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, err))
 		return
 	}
 	filter.ID = &id
-	cErr := h.service.Done(ctx, &filter)
+	version, cErr := ifMatchV1(r)
 	if cErr != nil {
-		if code, ok := errorMap[cErr.Err]; ok {
-			cErr.Code = code
-		} else {
-			cErr.Code = http.StatusInternalServerError
-		}
-		sendJSONError(w, cErr)
+		sendJSONError(w, r, cErr)
+		return
+	}
+	_, cErr = h.service.Done(ctx, &filter, version)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(domain.Task{})
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 	}
 }
 
@@ -239,28 +323,28 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 	searchID := r.URL.Query().Get("id")
 	if searchID == "" {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, domain.ErrID, nil))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, nil))
 		return
 	}
 	id, err := strconv.Atoi(searchID)
 	if err != nil {
-		sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, domain.ErrID, err))
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, err))
 		return
 	}
-	cErr := h.service.Delete(ctx, id)
+	version, cErr := ifMatchV1(r)
 	if cErr != nil {
-		if code, ok := errorMap[cErr.Err]; ok {
-			cErr.Code = code
-		} else {
-			cErr.Code = http.StatusInternalServerError
-		}
-		sendJSONError(w, cErr)
+		sendJSONError(w, r, cErr)
+		return
+	}
+	cErr = h.service.Delete(ctx, id, version)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(domain.Task{})
 	if err != nil {
-		log.Printf("Error writing response: %v", err)
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 	}
 }
 
@@ -268,30 +352,32 @@ func (h *TaskHandler) NextDateHandler(w http.ResponseWriter, r *http.Request) {
 	nowStr := r.URL.Query().Get("now")
 	dateStr := r.URL.Query().Get("date")
 	repeat := r.URL.Query().Get("repeat")
+	lang := i18n.FromContext(r.Context())
 
 	var now time.Time
 	if nowStr == "" {
-		now = time.Now()
+		now = h.service.Now(r.Context())
 	} else {
 		var err error
 		now, err = time.Parse(dateForm, nowStr)
 		if err != nil {
-			http.Error(w, domain.ErrDate.Error(), http.StatusBadRequest)
+			http.Error(w, localize(lang, domain.ErrDate), http.StatusBadRequest)
 			return
 		}
 	}
 	if dateStr == "" {
-		http.Error(w, domain.ErrDate.Error(), http.StatusBadRequest)
+		http.Error(w, localize(lang, domain.ErrDate), http.StatusBadRequest)
 		return
 	}
 	_, err := time.Parse(dateForm, dateStr)
 	if err != nil {
-		http.Error(w, domain.ErrDate.Error(), http.StatusBadRequest)
+		http.Error(w, localize(lang, domain.ErrDate), http.StatusBadRequest)
 		return
 	}
 	nextDate, err := h.service.NextDate(now, dateStr, repeat)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("ошибка вычисления следующей даты: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("%s: %s", i18n.Translate(lang, "nextdate_failed", ""), localize(lang, err)),
+			http.StatusInternalServerError)
 		return
 	}
 
@@ -1,87 +1,260 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/agidelle/TODO_web_v2/internal/service"
 	"github.com/golang-jwt/jwt/v5"
-	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (h *TaskHandler) Login(passStored, jwtkey string) http.HandlerFunc {
+// DefaultAccount - учетная запись, если в запросе на вход не указан login
+const DefaultAccount string = "admin"
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func sendTooManyLogins(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	sendJSONError(w, r, domain.NewCustomError(0, domain.ErrTooManyLogins, nil))
+}
+
+func (h *TaskHandler) Login(passStored string, keys *jwks.KeySet) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var password struct {
+			Login    string `json:"login"`
 			Password string `json:"password"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&password); err != nil {
-			sendJSONError(w, domain.NewCustomError(http.StatusBadRequest, errors.New("ошибка десериализации JSON"), nil))
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, nil))
 			return
 		}
+		account := password.Login
+		if account == "" {
+			account = DefaultAccount
+		}
+		ip := clientIP(r)
+
+		if h.loginGuard != nil {
+			retryAfter, cErr := h.loginGuard.Check(r.Context(), ip, account)
+			if cErr != nil {
+				if cErr.Err == domain.ErrTooManyLogins {
+					h.countLogin(loginPassword, loginLocked)
+					sendTooManyLogins(w, r, retryAfter)
+					return
+				}
+				sendJSONError(w, r, cErr)
+				return
+			}
+		}
+
 		hash, err := hashPassword(password.Password)
 		if err != nil {
-			sendJSONError(w, domain.NewCustomError(http.StatusInternalServerError, errors.New("ошибка создания хэша пароля"), nil))
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
 			return
 		}
-		if password.Password != passStored {
-			sendJSONError(w, domain.NewCustomError(http.StatusUnauthorized, errors.New("не правильный пароль"), nil))
+		if account != DefaultAccount || password.Password != passStored {
+			h.loginFailed(w, r, loginPassword, ip, account, domain.ErrPassword)
 			return
 		}
+
+		// При подключенной 2FA пароль - только первый шаг: вместо сессии
+		// выдаем короткоживущий токен для ввода кода
+		if h.twoFactor != nil {
+			enabled, cErr := h.twoFactor.Enabled(r.Context(), account)
+			if cErr != nil {
+				sendJSONError(w, r, cErr)
+				return
+			}
+			if enabled {
+				mfaToken, err := generateMFAToken(keys, account)
+				if err != nil {
+					sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
+					return
+				}
+				err = json.NewEncoder(w).Encode(map[string]any{"mfa_required": true, "mfa_token": mfaToken})
+				if err != nil {
+					logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+				}
+				return
+			}
+		}
+
+		if h.loginGuard != nil {
+			if cErr := h.loginGuard.Succeed(r.Context(), ip, account); cErr != nil {
+				sendJSONError(w, r, cErr)
+				return
+			}
+		}
+		token, err := GenerateJWT(keys)
 		if err != nil {
-			sendJSONError(w, domain.NewCustomError(http.StatusUnauthorized, errors.New("неправильный пароль"), nil))
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
 			return
 		}
-		token, err := GenerateJWT(jwtkey)
+		h.countLogin(loginPassword, loginSuccess)
 		err = json.NewEncoder(w).Encode(map[string]string{"token": token, "hash": hash})
 		if err != nil {
-			log.Printf("Error writing response: %v", err)
+			logging.FromContext(r.Context()).Error("Error writing response", "error", err)
 		}
 	}
 }
 
-func (h *TaskHandler) JWTMiddleware(pass, secretKey string) func(next http.Handler) http.Handler {
+// loginFailed учитывает неудачную попытку входа способом method и отвечает 401 или 429 при блокировке
+func (h *TaskHandler) loginFailed(w http.ResponseWriter, r *http.Request, method, ip, account string, reason error) {
+	h.countLogin(method, loginFailure)
+	if h.loginGuard != nil {
+		retryAfter, cErr := h.loginGuard.Fail(r.Context(), ip, account)
+		if cErr != nil {
+			sendJSONError(w, r, cErr)
+			return
+		}
+		if retryAfter > 0 {
+			sendTooManyLogins(w, r, retryAfter)
+			return
+		}
+	}
+	sendJSONError(w, r, domain.NewCustomError(0, reason, nil))
+}
+
+type ctxKey int
+
+const principalKey ctxKey = iota
+
+// Principal описывает, кем аутентифицирован запрос: сессией (JWT) или API-токеном
+type Principal struct {
+	Session bool
+	Token   *domain.APIToken
+}
+
+func (p *Principal) Allows(scope domain.Scope) bool {
+	if p.Session {
+		return true
+	}
+	return p.Token != nil && p.Token.HasScope(scope)
+}
+
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
+
+// bearerToken достает токен из заголовка Authorization, а при его отсутствии - из cookie
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, value, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(value)
+		}
+		return ""
+	}
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requiredScope - чтение для безопасных методов, запись для остальных
+func requiredScope(method string) domain.Scope {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return domain.ScopeRead
+	default:
+		return domain.ScopeWrite
+	}
+}
+
+func (h *TaskHandler) JWTMiddleware(pass string, keys *jwks.KeySet) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie("token")
-			if err != nil {
+			raw := bearerToken(r)
+			if raw == "" {
+				sendJSONError(w, r, domain.NewCustomError(0, domain.ErrUnauthorized, nil))
 				return
 			}
-			token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("неправильный метод шифрования token: %v", token.Header["alg"])
+
+			var principal *Principal
+			if service.IsAPIToken(raw) && h.tokens != nil {
+				token, cErr := h.tokens.Authenticate(r.Context(), raw)
+				if cErr != nil {
+					sendJSONError(w, r, cErr)
+					return
 				}
-				return []byte(secretKey), nil
-			})
-			if err != nil || !token.Valid {
-				http.Error(w, "не авторизован.", http.StatusUnauthorized)
+				principal = &Principal{Token: token}
+			} else {
+				// Токены первого шага входа с 2FA и состояния OIDC сессией не являются
+				if _, err := parseToken(keys, raw, typSession); err != nil {
+					sendJSONError(w, r, domain.NewCustomError(0, domain.ErrUnauthorized, err))
+					return
+				}
+				principal = &Principal{Session: true}
+			}
+
+			if !principal.Allows(requiredScope(r.Method)) {
+				sendJSONError(w, r, domain.NewCustomError(0, domain.ErrScope, nil))
 				return
 			}
-			next.ServeHTTP(w, r)
+			ctx := setRequestUser(r.Context(), principal)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, principalKey, principal)))
 		})
 	}
 }
 
-func GenerateJWT(jwtkey string) (string, error) {
-	claims := jwt.MapClaims{
-		"exp": time.Now().Add(24 * time.Hour).Unix(),
-		"iat": time.Now().Unix(),
-	}
-	if jwtkey == "" {
-		return "", errors.New("отсутствие jwt-key")
-	}
+// Назначения токенов, которые выдает сервер
+const (
+	typSession   string = "session"
+	typMFA       string = "mfa"
+	typOIDCState string = "oidc_state"
+)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// tokenIssuer - iss всех токенов сервера
+const tokenIssuer string = "todo_web"
+
+// signToken подписывает токен назначения typ. Все токены подписаны одним
+// ключом, который опубликован в JWKS, поэтому назначение записывается и в typ,
+// и в aud: сторонний сервис, проверяющий аудиторию, не примет токен первого
+// шага входа за сессию.
+func signToken(keys *jwks.KeySet, typ string, ttl time.Duration, claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims["iss"] = tokenIssuer
+	claims["aud"] = typ
+	claims["typ"] = typ
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	return keys.Sign(claims)
+}
 
-	tokenSign, err := token.SignedString([]byte(jwtkey))
+// parseToken проверяет подпись, срок, издателя и назначение токена
+func parseToken(keys *jwks.KeySet, raw, typ string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := keys.Parse(raw, claims,
+		jwt.WithIssuer(tokenIssuer), jwt.WithAudience(typ), jwt.WithExpirationRequired())
 	if err != nil {
-		return "", errors.New("ошибка подписи jwt")
+		return nil, err
 	}
+	if !token.Valid || claims["typ"] != typ {
+		return nil, fmt.Errorf("токен с назначением %v вместо %s", claims["typ"], typ)
+	}
+	return claims, nil
+}
 
-	return tokenSign, nil
+func GenerateJWT(keys *jwks.KeySet) (string, error) {
+	return signToken(keys, typSession, 24*time.Hour, jwt.MapClaims{})
 }
 
 func hashPassword(password string) (string, error) {
@@ -97,3 +270,15 @@ func hashPassword(password string) (string, error) {
 func checkPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// JWKSHandler публикует открытые ключи, чтобы другие сервисы могли проверять наши токены
+func JWKSHandler(keys *jwks.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		err := json.NewEncoder(w).Encode(keys.Public())
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+		}
+	}
+}
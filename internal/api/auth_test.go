@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeTokens принимает токены из заранее заданного набора
+type fakeTokens map[string]*domain.APIToken
+
+func (f fakeTokens) Create(context.Context, string, []domain.Scope, time.Duration) (string, *domain.APIToken, *domain.CustomError) {
+	return "", nil, domain.NewCustomError(0, domain.ErrInternalServer, nil)
+}
+
+func (f fakeTokens) List(context.Context) ([]*domain.APIToken, *domain.CustomError) {
+	return nil, nil
+}
+
+func (f fakeTokens) Revoke(context.Context, int64) *domain.CustomError {
+	return nil
+}
+
+func (f fakeTokens) Authenticate(_ context.Context, raw string) (*domain.APIToken, *domain.CustomError) {
+	token, ok := f[raw]
+	if !ok {
+		return nil, domain.NewCustomError(0, domain.ErrToken, nil)
+	}
+	return token, nil
+}
+
+func TestJWTMiddlewareScopes(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := GenerateJWT(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, WithTokens(fakeTokens{
+		"todo_read":  {ID: 1, Scopes: []domain.Scope{domain.ScopeRead}},
+		"todo_write": {ID: 2, Scopes: []domain.Scope{domain.ScopeWrite}},
+		"todo_none":  {ID: 3},
+	}))
+	protected := h.JWTMiddleware("pass", keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		token  string
+		method string
+		want   int
+	}{
+		{"todo_read", http.MethodGet, http.StatusNoContent},
+		{"todo_read", http.MethodHead, http.StatusNoContent},
+		{"todo_read", http.MethodPost, http.StatusForbidden},
+		{"todo_read", http.MethodPut, http.StatusForbidden},
+		{"todo_read", http.MethodDelete, http.StatusForbidden},
+		{"todo_write", http.MethodGet, http.StatusNoContent},
+		{"todo_write", http.MethodPost, http.StatusNoContent},
+		{"todo_write", http.MethodDelete, http.StatusNoContent},
+		{"todo_none", http.MethodGet, http.StatusForbidden},
+		{"todo_unknown", http.MethodGet, http.StatusUnauthorized},
+		{session, http.MethodGet, http.StatusNoContent},
+		{session, http.MethodDelete, http.StatusNoContent},
+		{"", http.MethodGet, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/tasks", nil)
+		if tt.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s с токеном %.12q: статус %d, ожидался %d", tt.method, tt.token, w.Code, tt.want)
+		}
+	}
+}
+
+func TestTokenManagementRequiresSession(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, WithTokens(fakeTokens{
+		"todo_write": {ID: 2, Scopes: []domain.Scope{domain.ScopeWrite}},
+	}))
+	protected := h.JWTMiddleware("pass", keys)(http.HandlerFunc(h.ListTokens))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/tokens", nil)
+	r.Header.Set("Authorization", "Bearer todo_write")
+	w := httptest.NewRecorder()
+	protected.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("API-токен получил список токенов: статус %d", w.Code)
+	}
+}
+
+func TestTokenPurposes(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := GenerateJWT(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa, err := generateMFAToken(keys, DefaultAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := signToken(keys, typOIDCState, time.Minute, jwt.MapClaims{"state": "state"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Токен прежнего формата: только exp и iat, без издателя и назначения
+	legacy, err := keys.Sign(jwt.MapClaims{"exp": time.Now().Add(time.Hour).Unix(), "iat": time.Now().Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signToken(keys, typSession, -time.Minute, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := map[string]string{"session": session, "mfa": mfa, "oidc_state": state, "legacy": legacy, "expired": expired}
+	accepts := map[string]string{typSession: "session", typMFA: "mfa", typOIDCState: "oidc_state"}
+	for typ, valid := range accepts {
+		for name, raw := range tokens {
+			_, err := parseToken(keys, raw, typ)
+			if (err == nil) != (name == valid) {
+				t.Errorf("parseToken(%s, %s): %v", name, typ, err)
+			}
+		}
+	}
+	if account, err := parseMFAToken(mfa, keys); err != nil || account != DefaultAccount {
+		t.Errorf("parseMFAToken = %q, %v", account, err)
+	}
+}
+
+// stubMetrics отдает пустой ответ вместо метрик
+type stubMetrics struct{}
+
+func (stubMetrics) ObserveRequest(string, string, int, time.Duration) {}
+
+func (stubMetrics) ObserveLogin(string, string) {}
+
+func (stubMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+}
+
+func TestMetricsRequiresAuth(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, WithMetrics(stubMetrics{}), WithTokens(fakeTokens{
+		"todo_read": {ID: 1, Scopes: []domain.Scope{domain.ScopeRead}},
+	}))
+	router := h.Router("pass", keys)
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "todo_read": http.StatusOK} {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Errorf("/metrics с токеном %q: статус %d, ожидался %d", token, w.Code, want)
+		}
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "2024-01.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jwks.LoadKeySet(dir, "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	JWKSHandler(keys).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("статус %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var set jwks.Set
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	// Общий секрет HS256 не публикуется, остается только ключ Ed25519
+	if len(set.Keys) != 1 {
+		t.Fatalf("ключей в JWKS %d, ожидался 1: %+v", len(set.Keys), set.Keys)
+	}
+	want := jwks.Key{Kty: "OKP", Kid: "2024-01", Use: "sig", Alg: "EdDSA", Crv: "Ed25519",
+		X: base64.RawURLEncoding.EncodeToString(private.Public().(ed25519.PublicKey))}
+	if set.Keys[0] != want {
+		t.Errorf("JWK = %+v, ожидалось %+v", set.Keys[0], want)
+	}
+
+	// По опубликованному набору проверяется токен, выданный сервером
+	session, err := GenerateJWT(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := jwks.Parse(w.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = jwt.Parse(session, func(token *jwt.Token) (interface{}, error) {
+		return public[token.Header["kid"].(string)], nil
+	}, jwt.WithValidMethods([]string{"EdDSA"}))
+	if err != nil {
+		t.Errorf("токен не проверен по JWKS: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+)
+
+const (
+	batchAtomic     = "atomic"
+	batchBestEffort = "best_effort"
+)
+
+type batchRequest struct {
+	// Mode - atomic (по умолчанию, все или ничего) или best_effort
+	Mode       string           `json:"mode"`
+	Operations []domain.BatchOp `json:"operations"`
+}
+
+type batchItem struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	Status int          `json:"status"`
+	Task   *domain.Task `json:"task,omitempty"`
+	Code   string       `json:"code,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// Batch - POST /api/tasks/batch: несколько операций create, update, done,
+// delete и move в одной транзакции. Ответ содержит результат каждой операции;
+// committed показывает, зафиксированы ли изменения.
+func (h *TaskHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, err))
+		return
+	}
+	var atomic bool
+	switch req.Mode {
+	case "", batchAtomic:
+		atomic = true
+	case batchBestEffort:
+	default:
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrParam,
+			fmt.Errorf("mode %q, доступны: %s, %s", req.Mode, batchAtomic, batchBestEffort)))
+		return
+	}
+
+	results, committed, cErr := h.service.Batch(ctx, req.Operations, atomic)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+
+	lang := i18n.FromContext(r.Context())
+	items := make([]batchItem, 0, len(results))
+	for _, res := range results {
+		item := batchItem{Index: res.Index, Op: res.Op, Task: res.Task, Status: http.StatusOK}
+		switch {
+		case res.Err != nil:
+			item.Status = errorStatusV1(res.Err)
+			p := newProblem(res.Err, item.Status, lang)
+			item.Code, item.Error = p.Code, p.Detail
+		case res.Op == domain.BatchCreate:
+			item.Status = http.StatusCreated
+		}
+		items = append(items, item)
+	}
+	writeJSON(w, r, http.StatusOK, struct {
+		Committed bool        `json:"committed"`
+		Results   []batchItem `json:"results"`
+	}{
+		Committed: committed,
+		Results:   items,
+	})
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+)
+
+// debugNowHeader задает время одного запроса на тестовых стендах:
+// дата 20240126, время RFC 3339 или смещение вида +72h
+const debugNowHeader string = "X-Debug-Now"
+
+// WithDebugClock разрешает заголовок X-Debug-Now. Только для тестовых стендов:
+// клиент сможет выполнять запросы "в другой день".
+func WithDebugClock(enabled bool) HandlerOption {
+	return func(h *TaskHandler) {
+		h.debugClock = enabled
+	}
+}
+
+// debugClockMiddleware подменяет часы сервиса для запроса с заголовком X-Debug-Now
+// и возвращает в этом же заголовке время, по которому выполнен запрос
+func (h *TaskHandler) debugClockMiddleware(next http.Handler) http.Handler {
+	if !h.debugClock {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(debugNowHeader)
+		if value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		clock, err := service.ParseClock(value, h.service.Clock())
+		if err != nil {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrParam, domain.NewMessage("debug_clock_header", "%s: %s", debugNowHeader, err)))
+			return
+		}
+		w.Header().Set(debugNowHeader, clock.Now().Format(time.RFC3339))
+		next.ServeHTTP(w, r.WithContext(service.WithRequestClock(r.Context(), clock)))
+	})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// createdDate создает задачу без даты и возвращает дату, которую ей
+// назначил сервис, и заголовок X-Debug-Now ответа
+func createdDate(t *testing.T, c *v2Client, header ...string) (date, echo string) {
+	t.Helper()
+	w := c.do(http.MethodPost, "/api/v2/tasks", `{"title":"Отчет"}`, header...)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("создание: статус %d, тело %s", w.Code, w.Body)
+	}
+	var created struct {
+		Data domain.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	return created.Data.Date, w.Header().Get(debugNowHeader)
+}
+
+func TestDebugClockDisabled(t *testing.T) {
+	c := newV2Client(t, WithDebugClock(false))
+
+	date, echo := createdDate(t, c, debugNowHeader, "20240301")
+	if date != "20240126" || echo != "" {
+		t.Errorf("заголовок учтен без WithDebugClock: дата %s, ответ %q", date, echo)
+	}
+	// Даже некорректное значение просто пропускается
+	if date, _ = createdDate(t, c, debugNowHeader, "вчера"); date != "20240126" {
+		t.Errorf("дата %s", date)
+	}
+}
+
+func TestDebugClockForms(t *testing.T) {
+	c := newV2Client(t, WithDebugClock(true))
+
+	tests := []struct {
+		value string
+		date  string
+		echo  time.Time
+	}{
+		{"20240301", "20240301", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local)},
+		{"2024-03-05T10:30:00Z", "20240305", time.Date(2024, time.March, 5, 10, 30, 0, 0, time.UTC)},
+		{" 2024-03-05T23:30:00-02:00 ", "20240305", time.Date(2024, time.March, 6, 1, 30, 0, 0, time.UTC)},
+		// Смещение отсчитывается от часов сервиса: 26.01.2024 12:00 UTC
+		{"+72h", "20240129", time.Date(2024, time.January, 29, 12, 0, 0, 0, time.UTC)},
+		{"-30m", "20240126", time.Date(2024, time.January, 26, 11, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		date, echo := createdDate(t, c, debugNowHeader, tt.value)
+		if date != tt.date {
+			t.Errorf("%q: дата задачи %s, ожидалось %s", tt.value, date, tt.date)
+		}
+		got, err := time.Parse(time.RFC3339, echo)
+		if err != nil || !got.Equal(tt.echo) {
+			t.Errorf("%q: в ответе %s %q, ожидалось %s", tt.value, debugNowHeader, echo, tt.echo.Format(time.RFC3339))
+		}
+	}
+
+	// Без заголовка запрос идет по часам сервиса, и в ответе заголовка нет
+	if date, echo := createdDate(t, c); date != "20240126" || echo != "" {
+		t.Errorf("без заголовка: дата %s, ответ %q", date, echo)
+	}
+}
+
+func TestDebugClockInvalid(t *testing.T) {
+	c := newV2Client(t, WithDebugClock(true))
+
+	for _, value := range []string{"завтра", "2024-03-01", "72h", "+3 days", "20241301"} {
+		w := c.do(http.MethodPost, "/api/v2/tasks", `{"title":"Отчет"}`, debugNowHeader, value, "Accept-Language", "en")
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: статус %d", value, w.Code)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != problemType {
+			t.Errorf("%q: Content-Type = %q", value, ct)
+		}
+		var p problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		want := "invalid parameter value: X-Debug-Now: expected a date 20060102, an RFC 3339 time or an offset like +72h"
+		if p.Code != domain.ErrParam.Code || p.Detail != want {
+			t.Errorf("%q: problem = %+v", value, p)
+		}
+		if echo := w.Header().Get(debugNowHeader); echo != "" {
+			t.Errorf("%q: в ответе с ошибкой %s = %q", value, debugNowHeader, echo)
+		}
+	}
+}
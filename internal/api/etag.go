@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func setETag(w http.ResponseWriter, task *domain.Task) {
+	if task != nil && task.Version > 0 {
+		w.Header().Set("ETag", etag(task.Version))
+	}
+}
+
+// ifMatch возвращает версию задачи из обязательного заголовка If-Match (v2).
+// Клиент, которому версия не важна, явно передает "*": это дает 0 - запись
+// без проверки версии.
+func ifMatch(r *http.Request) (int64, *domain.CustomError) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, domain.NewCustomError(0, domain.ErrNoPrecondition, nil)
+	}
+	if header == "*" {
+		return 0, nil
+	}
+	// Нашу задачу может описывать только один ETag, список не поддерживаем
+	value := strings.TrimPrefix(header, "W/")
+	version, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, domain.NewCustomError(0, domain.ErrVersion, err)
+	}
+	return version, nil
+}
+
+// ifMatchV1 - If-Match для API v1: старые клиенты заголовок не передают,
+// поэтому без него запись идет без проверки версии
+func ifMatchV1(r *http.Request) (int64, *domain.CustomError) {
+	if strings.TrimSpace(r.Header.Get("If-Match")) == "" {
+		return 0, nil
+	}
+	return ifMatch(r)
+}
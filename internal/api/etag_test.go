@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		header  string
+		version int64
+		err     *domain.Error
+	}{
+		{"", 0, domain.ErrNoPrecondition},
+		{"*", 0, nil},
+		{`"3"`, 3, nil},
+		{`W/"3"`, 3, nil},
+		{"3", 3, nil},
+		{`"0"`, 0, domain.ErrVersion},
+		{`"x"`, 0, domain.ErrVersion},
+		{`"1", "2"`, 0, domain.ErrVersion},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/task", nil)
+		if tt.header != "" {
+			r.Header.Set("If-Match", tt.header)
+		}
+		version, cErr := ifMatch(r)
+		if version != tt.version || (cErr == nil) != (tt.err == nil) || cErr != nil && cErr.Err != tt.err {
+			t.Errorf("If-Match %q: %d, %v", tt.header, version, cErr)
+		}
+	}
+}
+
+// На v1 If-Match необязателен: без него запись идет без проверки версии,
+// а переданный заголовок по-прежнему проверяется
+func TestV1IfMatchIsOptional(t *testing.T) {
+	c := newV2Client(t)
+
+	w := c.do(http.MethodPost, "/api/task", `{"title":"Отчет","date":"20240201"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("создание: статус %d, тело %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.ID == 0 {
+		t.Fatalf("создание: %s", w.Body)
+	}
+	id := strconv.FormatInt(created.ID, 10)
+	update := `{"id":"` + id + `","title":"Годовой отчет","date":"20240201"}`
+
+	tests := []struct {
+		method  string
+		target  string
+		body    string
+		ifMatch string
+		status  int
+	}{
+		{http.MethodPut, "/api/task", update, "", http.StatusOK},
+		{http.MethodPut, "/api/task", update, "", http.StatusOK},
+		{http.MethodPut, "/api/task", update, `"1"`, http.StatusPreconditionFailed},
+		{http.MethodPut, "/api/task", update, `"3"`, http.StatusOK},
+		{http.MethodPost, "/api/task/done?id=" + id, "", `"1"`, http.StatusPreconditionFailed},
+		{http.MethodPost, "/api/task/done?id=" + id, "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		var header []string
+		if tt.ifMatch != "" {
+			header = []string{"If-Match", tt.ifMatch}
+		}
+		if w := c.do(tt.method, tt.target, tt.body, header...); w.Code != tt.status {
+			t.Errorf("%s %s If-Match %q: статус %d, ожидалось %d, тело %s", tt.method, tt.target, tt.ifMatch, w.Code, tt.status, w.Body)
+		}
+	}
+
+	w = c.do(http.MethodPost, "/api/task", `{"title":"Звонок"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if w := c.do(http.MethodDelete, "/api/task?id="+strconv.FormatInt(created.ID, 10), ""); w.Code != http.StatusOK {
+		t.Errorf("удаление без If-Match: статус %d, тело %s", w.Code, w.Body)
+	}
+}
+
+func TestV2WritesRequireIfMatch(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := GenerateJWT(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := NewHandler(nil).Router("pass", keys)
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/api/v2/tasks/1", strings.NewReader(`{"title":"a"}`)),
+		httptest.NewRequest(http.MethodPatch, "/api/v2/tasks/1", strings.NewReader(`{"title":"a"}`)),
+		httptest.NewRequest(http.MethodPost, "/api/v2/tasks/1/done", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/v2/tasks/1", nil),
+	}
+	for _, r := range requests {
+		r.Header.Set("Authorization", "Bearer "+session)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusPreconditionRequired {
+			t.Errorf("%s %s без If-Match: статус %d", r.Method, r.URL, w.Code)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+)
+
+type SavedFilterService interface {
+	Create(ctx context.Context, filter *domain.SavedFilter) (int64, *domain.CustomError)
+	Get(ctx context.Context, id int64) (*domain.SavedFilter, *domain.CustomError)
+	List(ctx context.Context) ([]*domain.SavedFilter, *domain.CustomError)
+	Update(ctx context.Context, filter *domain.SavedFilter) *domain.CustomError
+	Delete(ctx context.Context, id int64) *domain.CustomError
+	Run(ctx context.Context, id int64, limit int, cursor string) (*domain.TaskPage, *domain.CustomError)
+	Counts(ctx context.Context) ([]domain.FilterCount, *domain.CustomError)
+}
+
+func filterID(r *http.Request) (int64, *domain.CustomError) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, domain.NewCustomError(0, domain.ErrID, err)
+	}
+	return id, nil
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
+
+func decodeSavedFilter(r *http.Request) (*domain.SavedFilter, *domain.CustomError) {
+	var req struct {
+		Name   string        `json:"name"`
+		Filter domain.Filter `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrBadJSON, err)
+	}
+	return &domain.SavedFilter{Name: req.Name, Filter: req.Filter}, nil
+}
+
+// CreateFilter - POST /api/filters
+func (h *TaskHandler) CreateFilter(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	filter, cErr := decodeSavedFilter(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	if _, cErr = h.filters.Create(ctx, filter); cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusCreated, filter)
+}
+
+// ListFilters - GET /api/filters
+func (h *TaskHandler) ListFilters(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	filters, cErr := h.filters.List(ctx)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, struct {
+		Filters []*domain.SavedFilter `json:"filters"`
+	}{
+		Filters: filters,
+	})
+}
+
+// GetFilter - GET /api/filters/{id}
+func (h *TaskHandler) GetFilter(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	id, cErr := filterID(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	filter, cErr := h.filters.Get(ctx, id)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, filter)
+}
+
+// UpdateFilter - PUT /api/filters/{id}, заменяет имя и условия фильтра
+func (h *TaskHandler) UpdateFilter(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	id, cErr := filterID(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	filter, cErr := decodeSavedFilter(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	filter.ID = id
+	if cErr = h.filters.Update(ctx, filter); cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, filter)
+}
+
+// DeleteFilter - DELETE /api/filters/{id}
+func (h *TaskHandler) DeleteFilter(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	id, cErr := filterID(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	if cErr = h.filters.Delete(ctx, id); cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, struct{}{})
+}
+
+// FilterTasks - GET /api/filters/{id}/tasks?limit=&cursor=, задачи сохраненного фильтра
+func (h *TaskHandler) FilterTasks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	id, cErr := filterID(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	var limit int
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrLimit, err))
+			return
+		}
+		limit = n
+	}
+	page, cErr := h.filters.Run(ctx, id, limit, r.URL.Query().Get("cursor"))
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	sendJSONTasks(w, r, page)
+}
+
+// FilterCounts - GET /api/filters/counts, число задач в каждом фильтре для бейджей
+func (h *TaskHandler) FilterCounts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	counts, cErr := h.filters.Counts(ctx)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, struct {
+		Counts []domain.FilterCount `json:"counts"`
+	}{
+		Counts: counts,
+	})
+}
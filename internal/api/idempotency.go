@@ -0,0 +1,171 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+)
+
+// Максимальный размер тела запроса, который хэшируется для Idempotency-Key
+const maxIdempotentBody int64 = 1 << 20
+
+// Заголовки, которые относятся к конкретному запросу, а не к ответу:
+// при повторе их выставляет новый запрос, поэтому они не сохраняются
+var perRequestHeaders = []string{requestIDHeader, "Content-Language", debugNowHeader}
+
+// storedHeader - заголовки ответа для сохранения без заголовков запроса
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	for _, name := range perRequestHeaders {
+		stored.Del(name)
+	}
+	return stored
+}
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, key, hash string) (*domain.IdempotencyRecord, *domain.CustomError)
+	Finish(ctx context.Context, record *domain.IdempotencyRecord) *domain.CustomError
+	Abort(ctx context.Context, key string) *domain.CustomError
+}
+
+// idempotencyScope отделяет ключи разных токенов друг от друга и от сессии
+func idempotencyScope(p *Principal) string {
+	if p != nil && p.Token != nil {
+		return "token:" + strconv.FormatInt(p.Token.ID, 10) + ":"
+	}
+	return "session:"
+}
+
+// requestHash - отпечаток запроса: метод, путь с параметрами и тело
+func requestHash(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// responseRecorder передает ответ клиенту и одновременно запоминает его
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent выполняет запрос с заголовком Idempotency-Key не больше одного
+// раза: повтор с тем же телом получает сохраненный ответ, повтор с другим
+// телом отклоняется. Ответы 5xx не сохраняются, чтобы запрос можно было повторить.
+// Запросы без заголовка обрабатываются как обычно.
+func (h *TaskHandler) idempotent(next http.Handler) http.Handler {
+	if h.idempotency == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !service.ValidKey(key) {
+			w.Header().Set("Content-Type", "application/json")
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrIdempotencyKey, nil))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			sendJSONError(w, r, domain.NewCustomError(http.StatusRequestEntityTooLarge, domain.ErrIdempotencyKey, err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key = idempotencyScope(PrincipalFromContext(r.Context())) + key
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		stored, cErr := h.idempotency.Begin(ctx, key, requestHash(r, body))
+		cancel()
+		if cErr != nil {
+			w.Header().Set("Content-Type", "application/json")
+			if cErr.Err == domain.ErrIdempotencyBusy {
+				w.Header().Set("Retry-After", "1")
+			}
+			sendJSONError(w, r, cErr)
+			return
+		}
+		if stored != nil {
+			maps.Copy(w.Header(), stored.Header)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			if _, err := w.Write(stored.Body); err != nil {
+				logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+			}
+			return
+		}
+
+		// Клиент мог уже отключиться, а ответ сохранить все равно нужно
+		saveCtx := context.WithoutCancel(r.Context())
+		defer func() {
+			// Паника в обработчике: освобождаем ключ и передаем панику дальше
+			if p := recover(); p != nil {
+				h.abortIdempotent(saveCtx, key)
+				panic(p)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		if rec.status >= http.StatusInternalServerError {
+			h.abortIdempotent(saveCtx, key)
+			return
+		}
+		ctx, cancel = context.WithTimeout(saveCtx, 5*time.Second)
+		defer cancel()
+		cErr = h.idempotency.Finish(ctx, &domain.IdempotencyRecord{
+			Key:         key,
+			RequestHash: requestHash(r, body),
+			Status:      rec.status,
+			Header:      storedHeader(w.Header()),
+			Body:        rec.body.Bytes(),
+		})
+		if cErr != nil {
+			logging.FromContext(r.Context()).Error("Error saving idempotent response", "error", cErr.Err, "cause", cErr.ErrStorage)
+		}
+	})
+}
+
+// abortIdempotent освобождает ключ, чтобы запрос можно было повторить
+func (h *TaskHandler) abortIdempotent(ctx context.Context, key string) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if cErr := h.idempotency.Abort(ctx, key); cErr != nil {
+		logging.FromContext(ctx).Error("Error releasing idempotency key", "error", cErr.Err, "cause", cErr.ErrStorage)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/agidelle/TODO_web_v2/internal/service"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// idempotentRequest отправляет POST с ключом key и заголовком X-Request-ID,
+// как его выставил бы logged
+func idempotentRequest(handler http.Handler, key, requestID, lang string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"title":"x"}`))
+	r.Header.Set("Idempotency-Key", key)
+	r.Header.Set("Accept-Language", lang)
+	w := httptest.NewRecorder()
+	w.Header().Set(requestIDHeader, requestID)
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotentReplayKeepsRequestHeaders(t *testing.T) {
+	h := NewHandler(nil, WithIdempotency(service.NewIdempotency(memory.NewIdempotencyStore(), 0)))
+	calls := 0
+	handler := h.localized(h.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/api/task?id=1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"1"}`))
+	})))
+
+	first := idempotentRequest(handler, "k1", "first", "en")
+	second := idempotentRequest(handler, "k1", "second", "ru")
+	if calls != 1 {
+		t.Fatalf("обработчик вызван %d раз", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() ||
+		second.Header().Get("Location") != "/api/task?id=1" || second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("повтор: статус %d, заголовки %v, тело %s", second.Code, second.Header(), second.Body)
+	}
+	if got := second.Header().Get(requestIDHeader); got != "second" {
+		t.Errorf("%s повтора = %q, ожидался идентификатор нового запроса", requestIDHeader, got)
+	}
+	if got := second.Header().Get("Content-Language"); got != "ru" {
+		t.Errorf("Content-Language повтора = %q", got)
+	}
+}
+
+func TestIdempotentPanicReleasesKey(t *testing.T) {
+	h := NewHandler(nil, WithIdempotency(service.NewIdempotency(memory.NewIdempotencyStore(), 0)))
+	panics := true
+	handler := h.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panics {
+			panic("сбой обработчика")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("паника не передана дальше")
+			}
+		}()
+		idempotentRequest(handler, "k1", "first", "en")
+	}()
+
+	panics = false
+	if w := idempotentRequest(handler, "k1", "second", "en"); w.Code != http.StatusCreated {
+		t.Errorf("повтор после паники: статус %d, ключ не освобожден", w.Code)
+	}
+}
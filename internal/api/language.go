@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+)
+
+// langCookie - выбор языка, сохраненный интерфейсом; важнее Accept-Language
+const langCookie string = "lang"
+
+// localized определяет язык сообщений для запроса и кладет его в контекст
+func (h *TaskHandler) localized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var preference string
+		if cookie, err := r.Cookie(langCookie); err == nil {
+			preference = cookie.Value
+		}
+		lang := i18n.Negotiate(preference, r.Header.Get("Accept-Language"), h.lang)
+		w.Header().Set("Content-Language", string(lang))
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(i18n.WithLang(r.Context(), lang)))
+	})
+}
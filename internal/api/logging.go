@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+)
+
+// requestIDHeader - идентификатор запроса: берется у клиента или прокси,
+// иначе создается, и возвращается в ответе
+const requestIDHeader string = "X-Request-ID"
+
+// Максимальная длина X-Request-ID, принимаемого от клиента
+const maxRequestID = 128
+
+// WithLogger задает логгер запросов, по умолчанию slog.Default()
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(h *TaskHandler) {
+		h.logger = logger
+	}
+}
+
+// statusWriter запоминает статус и размер ответа для журнала запросов
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.bytes += n
+	return n, err
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// requestUser - кем выполнен запрос; заполняется JWTMiddleware
+type requestUser struct {
+	name string
+}
+
+type requestUserKey struct{}
+
+// setRequestUser сообщает журналу запросов пользователя и добавляет его
+// к логгеру запроса
+func setRequestUser(ctx context.Context, p *Principal) context.Context {
+	name := "session"
+	if p.Token != nil {
+		name = "token:" + strconv.FormatInt(p.Token.ID, 10)
+	}
+	if user, ok := ctx.Value(requestUserKey{}).(*requestUser); ok {
+		user.name = name
+	}
+	return logging.With(ctx, "user", name)
+}
+
+// validRequestID принимает от клиента только короткие печатные идентификаторы
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logged присваивает запросу X-Request-ID, кладет в контекст логгер
+// с этим идентификатором и по завершении пишет запись о запросе
+func (h *TaskHandler) logged(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := h.logger
+		if logger == nil {
+			logger = slog.Default()
+		}
+		logger = logger.With("request_id", id)
+		user := &requestUser{}
+		ctx := context.WithValue(logging.WithLogger(r.Context(), logger), requestUserKey{}, user)
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Int("bytes", sw.bytes),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if user.name != "" {
+			attrs = append(attrs, slog.String("user", user.name))
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Способы и результаты входа для метрик
+const (
+	loginPassword = "password"
+	loginTOTP     = "totp"
+	loginOIDC     = "oidc"
+
+	loginSuccess = "success"
+	loginFailure = "failure"
+	loginLocked  = "locked"
+)
+
+type Metrics interface {
+	ObserveRequest(method, route string, status int, elapsed time.Duration)
+	ObserveLogin(method, result string)
+	Handler() http.Handler
+}
+
+// WithMetrics включает учет запросов и входов и маршрут GET /metrics,
+// доступный только после аутентификации
+func WithMetrics(metrics Metrics) HandlerOption {
+	return func(h *TaskHandler) {
+		h.metrics = metrics
+	}
+}
+
+// measured учитывает запрос по шаблону маршрута. Должен оборачивать сам
+// ServeMux: шаблон появляется в r.Pattern только после выбора маршрута.
+func (h *TaskHandler) measured(mux http.Handler) http.Handler {
+	if h.metrics == nil {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		mux.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		route := "unmatched"
+		if r.Pattern != "" {
+			// Метод уже есть в отдельной метке
+			_, path, found := strings.Cut(r.Pattern, " ")
+			if !found {
+				path = r.Pattern
+			}
+			route = path
+		}
+		h.metrics.ObserveRequest(r.Method, route, sw.status, time.Since(start))
+	})
+}
+
+// countLogin учитывает попытку входа, если метрики включены
+func (h *TaskHandler) countLogin(method, result string) {
+	if h.metrics != nil {
+		h.metrics.ObserveLogin(method, result)
+	}
+}
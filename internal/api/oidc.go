@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcStateCookie string        = "oidc_state"
+	oidcStateTTL    time.Duration = 10 * time.Minute
+)
+
+type OIDCService interface {
+	AuthRequest(ctx context.Context) (*service.OIDCRequest, *domain.CustomError)
+	Exchange(ctx context.Context, code, verifier, nonce string) (string, *domain.CustomError)
+}
+
+// OIDCLogin перенаправляет на провайдера. state, nonce и PKCE verifier
+// сохраняются в подписанной cookie, поэтому сервер не хранит состояние входа.
+func (h *TaskHandler) OIDCLogin(keys *jwks.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		req, cErr := h.oidc.AuthRequest(ctx)
+		if cErr != nil {
+			cErr.Code = http.StatusBadGateway
+			sendJSONError(w, r, cErr)
+			return
+		}
+		claims := jwt.MapClaims{
+			"state":    req.State,
+			"nonce":    req.Nonce,
+			"verifier": req.Verifier,
+		}
+		stateToken, err := signToken(keys, typOIDCState, oidcStateTTL, claims)
+		if err != nil {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    stateToken,
+			Path:     "/api/oidc",
+			MaxAge:   int(oidcStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, req.URL, http.StatusFound)
+	}
+}
+
+// OIDCCallback завершает вход и выдает ту же сессию, что и вход по паролю,
+// а при подключенной 2FA - токен для ввода кода
+func (h *TaskHandler) OIDCCallback(keys *jwks.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		query := r.URL.Query()
+		if providerErr := query.Get("error"); providerErr != "" {
+			sendJSONError(w, r, domain.NewCustomError(http.StatusUnauthorized, domain.ErrOIDC, fmt.Errorf("%s", providerErr)))
+			return
+		}
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil {
+			sendJSONError(w, r, domain.NewCustomError(http.StatusBadRequest, domain.ErrOIDC, err))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/oidc", MaxAge: -1})
+
+		claims, err := parseToken(keys, cookie.Value, typOIDCState)
+		if err != nil || claims["state"] != query.Get("state") {
+			sendJSONError(w, r, domain.NewCustomError(http.StatusBadRequest, domain.ErrOIDC, err))
+			return
+		}
+		verifier, _ := claims["verifier"].(string)
+		nonce, _ := claims["nonce"].(string)
+
+		account, cErr := h.oidc.Exchange(ctx, query.Get("code"), verifier, nonce)
+		if cErr != nil {
+			// Отказ провайдера на этом шаге - неудачный вход, а не сбой шлюза
+			if cErr.Err == domain.ErrOIDC {
+				cErr.Code = http.StatusUnauthorized
+			}
+			if cErr.Err == domain.ErrOIDC || cErr.Err == domain.ErrOIDCIdentity {
+				h.countLogin(loginOIDC, loginFailure)
+			}
+			sendJSONError(w, r, cErr)
+			return
+		}
+
+		// При подключенной 2FA провайдер подтверждает только первый фактор:
+		// дальше вход идет как после пароля, через POST /api/signin/2fa.
+		// Токен передается во фрагменте адреса, а фрагмент браузер не
+		// отправляет на сервер и в Referer.
+		if h.twoFactor != nil {
+			enabled, cErr := h.twoFactor.Enabled(ctx, account)
+			if cErr != nil {
+				sendJSONError(w, r, cErr)
+				return
+			}
+			if enabled {
+				mfaToken, err := generateMFAToken(keys, account)
+				if err != nil {
+					sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
+					return
+				}
+				http.Redirect(w, r, "/#"+url.Values{"mfa_token": {mfaToken}}.Encode(), http.StatusFound)
+				return
+			}
+		}
+
+		if h.loginGuard != nil {
+			if cErr = h.loginGuard.Succeed(ctx, clientIP(r), account); cErr != nil {
+				sendJSONError(w, r, cErr)
+				return
+			}
+		}
+
+		session, err := GenerateJWT(keys)
+		if err != nil {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     "token",
+			Value:    session,
+			Path:     "/",
+			MaxAge:   int((24 * time.Hour).Seconds()),
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		h.countLogin(loginOIDC, loginSuccess)
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeOIDC подтверждает любой код как вход учетной записи account
+type fakeOIDC struct {
+	account string
+}
+
+func (f fakeOIDC) AuthRequest(context.Context) (*service.OIDCRequest, *domain.CustomError) {
+	return &service.OIDCRequest{URL: "https://issuer.example.com/authorize", State: "state", Nonce: "nonce", Verifier: "verifier"}, nil
+}
+
+func (f fakeOIDC) Exchange(_ context.Context, _, verifier, nonce string) (string, *domain.CustomError) {
+	if verifier != "verifier" || nonce != "nonce" {
+		return "", domain.NewCustomError(0, domain.ErrOIDC, nil)
+	}
+	return f.account, nil
+}
+
+// fakeTwoFactor сообщает, включена ли 2FA, и принимает код "123456"
+type fakeTwoFactor struct {
+	enabled bool
+}
+
+func (f fakeTwoFactor) Enroll(context.Context, string) (*domain.Enrollment, *domain.CustomError) {
+	return nil, nil
+}
+
+func (f fakeTwoFactor) Confirm(context.Context, string, string) *domain.CustomError {
+	return nil
+}
+
+func (f fakeTwoFactor) Disable(context.Context, string, string) *domain.CustomError {
+	return nil
+}
+
+func (f fakeTwoFactor) Enabled(context.Context, string) (bool, *domain.CustomError) {
+	return f.enabled, nil
+}
+
+func (f fakeTwoFactor) Verify(_ context.Context, _, code string) *domain.CustomError {
+	if code != "123456" {
+		return domain.NewCustomError(0, domain.ErrOTPCode, nil)
+	}
+	return nil
+}
+
+func (f fakeTwoFactor) Redeem(context.Context, string, string) *domain.CustomError {
+	return domain.NewCustomError(0, domain.ErrOTPCode, nil)
+}
+
+// oidcCallback проходит callback с корректной cookie состояния
+func oidcCallback(t *testing.T, h *TaskHandler, keys *jwks.KeySet) *httptest.ResponseRecorder {
+	t.Helper()
+	state, err := signToken(keys, typOIDCState, time.Minute, jwt.MapClaims{
+		"state":    "state",
+		"nonce":    "nonce",
+		"verifier": "verifier",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=code&state=state", nil)
+	r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: state})
+	w := httptest.NewRecorder()
+	h.Router("pass", keys).ServeHTTP(w, r)
+	return w
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "token" && c.Value != "" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestOIDCCallbackIssuesSession(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, WithOIDC(fakeOIDC{account: DefaultAccount}), WithTwoFactor(fakeTwoFactor{}))
+
+	w := oidcCallback(t, h, keys)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("статус %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	if sessionCookie(w) == nil {
+		t.Error("сессия не выдана")
+	}
+}
+
+func TestOIDCCallbackRequiresTOTP(t *testing.T) {
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, WithOIDC(fakeOIDC{account: DefaultAccount}), WithTwoFactor(fakeTwoFactor{enabled: true}))
+
+	w := oidcCallback(t, h, keys)
+	if w.Code != http.StatusFound {
+		t.Fatalf("статус %d", w.Code)
+	}
+	if sessionCookie(w) != nil {
+		t.Fatal("сессия выдана без кода TOTP")
+	}
+	location := w.Header().Get("Location")
+	fragment, ok := strings.CutPrefix(location, "/#")
+	if !ok {
+		t.Fatalf("Location = %q", location)
+	}
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfaToken := values.Get("mfa_token")
+
+	// Токен первого шага не открывает API
+	r := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	r.Header.Set("Authorization", "Bearer "+mfaToken)
+	api := httptest.NewRecorder()
+	h.Router("pass", keys).ServeHTTP(api, r)
+	if api.Code != http.StatusUnauthorized {
+		t.Errorf("запрос с mfa_token: статус %d", api.Code)
+	}
+
+	body := `{"mfa_token":"` + mfaToken + `","code":"123456"}`
+	r = httptest.NewRequest(http.MethodPost, "/api/signin/2fa", strings.NewReader(body))
+	login := httptest.NewRecorder()
+	h.Router("pass", keys).ServeHTTP(login, r)
+	if login.Code != http.StatusOK || !strings.Contains(login.Body.String(), `"token"`) {
+		t.Errorf("второй шаг входа: статус %d, %s", login.Code, login.Body)
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+)
+
+const problemType string = "application/problem+json"
+
+// HTTP-статусы классов доменных ошибок
+var kindStatus = map[domain.Kind]int{
+	domain.KindValidation:           http.StatusBadRequest,
+	domain.KindNotFound:             http.StatusNotFound,
+	domain.KindConflict:             http.StatusConflict,
+	domain.KindPrecondition:         http.StatusPreconditionFailed,
+	domain.KindPreconditionRequired: http.StatusPreconditionRequired,
+	domain.KindUnprocessable:        http.StatusUnprocessableEntity,
+	domain.KindDependency:           http.StatusFailedDependency,
+	domain.KindUnauthorized:         http.StatusUnauthorized,
+	domain.KindForbidden:            http.StatusForbidden,
+	domain.KindTooManyRequests:      http.StatusTooManyRequests,
+	domain.KindUpstream:             http.StatusBadGateway,
+}
+
+// problem - описание ошибки по RFC 7807
+type problem struct {
+	Type   string              `json:"type"`
+	Title  string              `json:"title"`
+	Status int                 `json:"status"`
+	Detail string              `json:"detail"`
+	Code   string              `json:"code"`
+	Errors []domain.FieldError `json:"errors,omitempty"`
+	// Error повторяет detail для клиентов v1, которые читают поле error
+	Error string `json:"error,omitempty"`
+}
+
+// errorStatus возвращает статус, заданный в месте ошибки, или статус ее класса
+func errorStatus(cErr *domain.CustomError) int {
+	if cErr.Code != 0 {
+		return cErr.Code
+	}
+	if status, ok := kindStatus[domain.KindOf(cErr.Err)]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// localize переводит доменную ошибку или сообщение на язык lang; прочие
+// ошибки остаются как есть
+func localize(lang i18n.Lang, err error) string {
+	switch e := err.(type) {
+	case *domain.Error:
+		return i18n.Translate(lang, e.Code, e.Message)
+	case *domain.Message:
+		args := make([]any, len(e.Args))
+		for i, arg := range e.Args {
+			if argErr, ok := arg.(error); ok {
+				arg = localize(lang, argErr)
+			}
+			args[i] = arg
+		}
+		return i18n.Format(lang, e.Code, e.Text, args...)
+	case *service.QueryError:
+		return localize(lang, e.Message())
+	}
+	return err.Error()
+}
+
+func newProblem(cErr *domain.CustomError, status int, lang i18n.Lang) *problem {
+	p := &problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: localize(lang, cErr.Err),
+		Code:   domain.ErrInternalServer.Code,
+	}
+	for _, field := range cErr.Fields {
+		field.Detail = i18n.Translate(lang, field.Code, field.Detail)
+		p.Errors = append(p.Errors, field)
+	}
+	var dErr *domain.Error
+	if de, ok := cErr.Err.(*domain.Error); ok {
+		dErr = de
+		p.Code = de.Code
+	}
+	if status >= http.StatusInternalServerError {
+		// Подробности внутренних ошибок наружу не отдаем
+		p.Detail = localize(lang, domain.ErrInternalServer)
+		p.Code = domain.ErrInternalServer.Code
+		return p
+	}
+	// Обертка над той же ошибкой (например, из хранилища) только повторила бы
+	// detail, причем текстом на языке сервера
+	if cErr.ErrStorage != nil && domain.KindOf(cErr.Err) != domain.KindNotFound && !errors.Is(cErr.ErrStorage, cErr.Err) {
+		p.Detail += ": " + localize(lang, cErr.ErrStorage)
+	}
+	if len(p.Errors) == 0 && dErr != nil && dErr.Field != "" {
+		p.Errors = []domain.FieldError{{Pointer: dErr.Field, Code: dErr.Code, Detail: p.Detail}}
+	}
+	return p
+}
+
+// logProblem записывает причину ошибки 5xx: клиент ее не видит
+func logProblem(r *http.Request, cErr *domain.CustomError, status int) {
+	if status < http.StatusInternalServerError {
+		return
+	}
+	logging.FromContext(r.Context()).Error("Request failed",
+		"status", status, "error", cErr.Err, "cause", cErr.ErrStorage)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p *problem) {
+	w.Header().Set("Content-Type", problemType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
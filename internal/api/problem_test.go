@@ -0,0 +1,64 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+)
+
+func TestProblemDetailIsLocalized(t *testing.T) {
+	_, queryErr := service.ParseQuery(`report "open`, time.Now())
+	tests := []struct {
+		cErr *domain.CustomError
+		lang i18n.Lang
+		want string
+	}{
+		{domain.NewCustomError(0, domain.ErrQuery, queryErr), i18n.En,
+			"invalid search query: unclosed quote (position 8)"},
+		{domain.NewCustomError(0, domain.ErrQuery, queryErr), i18n.Ru,
+			"некорректный поисковый запрос: не закрыта кавычка (позиция 8)"},
+		{domain.NewCustomError(0, domain.ErrQuickAdd,
+			domain.NewMessage("quick_add_phrase", "%q: %s", "31 февраля", domain.NewMessage("quick_add_no_day", "в месяце нет %d-го числа", 31))), i18n.En,
+			`could not parse task text: "31 февраля": the month has no day 31`},
+		{domain.NewCustomError(0, domain.ErrSort, domain.NewMessage("sort_options", "%q, доступны: date, -date, title, -title", "x")), i18n.En,
+			`invalid sort order: "x", available: date, -date, title, -title`},
+	}
+	for _, tt := range tests {
+		if got := newProblem(tt.cErr, 400, tt.lang).Detail; got != tt.want {
+			t.Errorf("detail (%s) = %q, ожидалось %q", tt.lang, got, tt.want)
+		}
+	}
+}
+
+// Текст хранилища, обернувший доменную ошибку, не попадает в detail:
+// иначе клиент получил бы русский текст и имя ограничения БД
+func TestProblemHidesStorageText(t *testing.T) {
+	tests := []struct {
+		cErr   *domain.CustomError
+		status int
+		lang   i18n.Lang
+		want   string
+	}{
+		{domain.NewCustomError(0, domain.ErrVersion, fmt.Errorf("версия задачи в БД изменилась: %w", domain.ErrVersion)),
+			http.StatusPreconditionFailed, i18n.En, "task was modified by another request"},
+		{domain.NewCustomError(0, domain.ErrFilterExists, fmt.Errorf("saved_filters_name_key: %w", domain.ErrFilterExists)),
+			http.StatusConflict, i18n.En, "a filter with this name already exists"},
+		{domain.NewCustomError(0, domain.ErrFilterExists, fmt.Errorf("saved_filters_name_key: %w", domain.ErrFilterExists)),
+			http.StatusConflict, i18n.Ru, "фильтр с таким именем уже существует"},
+		{domain.NewCustomError(0, domain.ErrCursor, domain.NewMessage("cursor_sort", "курсор получен для другой сортировки")),
+			http.StatusBadRequest, i18n.En, "invalid page cursor: the cursor was issued for a different sort order"},
+	}
+	for _, tt := range tests {
+		if status := errorStatus(tt.cErr); status != tt.status {
+			t.Errorf("%v: статус %d, ожидалось %d", tt.cErr.Err, status, tt.status)
+		}
+		if got := newProblem(tt.cErr, tt.status, tt.lang).Detail; got != tt.want {
+			t.Errorf("detail (%s) = %q, ожидалось %q", tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+type quickAddRequest struct {
+	Text string `json:"text"`
+}
+
+func decodeQuickAdd(r *http.Request) (string, *domain.CustomError) {
+	var req quickAddRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return "", domain.NewCustomError(0, domain.ErrBadJSON, nil)
+	}
+	return req.Text, nil
+}
+
+// QuickAddPreview - POST /api/task/quick/preview: показывает, как будет
+// разобран текст, ничего не сохраняя
+func (h *TaskHandler) QuickAddPreview(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	text, cErr := decodeQuickAdd(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	task, cErr := h.service.QuickAddPreview(r.Context(), text)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, task)
+}
+
+// QuickAdd - POST /api/task/quick: создает задачу из текста вида
+// "Pay rent every month on the 1st #home !high" или "Позвонить маме завтра"
+func (h *TaskHandler) QuickAdd(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	text, cErr := decodeQuickAdd(r)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	task, cErr := h.service.QuickAdd(ctx, text)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	setETag(w, task)
+	writeJSON(w, r, http.StatusCreated, task)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+)
+
+// Сколько ближайших дат возвращать по умолчанию
+const defaultRepeatPreview = 3
+
+type repeatResponse struct {
+	// Rule - правило в каноническом виде
+	Rule        string   `json:"rule"`
+	Description string   `json:"description"`
+	Next        []string `json:"next"`
+}
+
+// DescribeRepeat - GET /api/repeat?rule=m 2,15 3,6&date=20240126&count=3:
+// описание правила повторения и ближайшие даты для интерфейса
+func (h *TaskHandler) DescribeRepeat(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+
+	count := defaultRepeatPreview
+	if raw := query.Get("count"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrParam, fmt.Errorf("count %q", raw)))
+			return
+		}
+		count = n
+	}
+	rule, dates, cErr := h.service.RepeatPreview(r.Context(), query.Get("rule"), query.Get("date"), count)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+
+	lang := i18n.FromContext(r.Context())
+	res := repeatResponse{Description: i18n.Translate(lang, "repeat_none", ""), Next: []string{}}
+	if rule != nil {
+		res.Rule = rule.String()
+		res.Description = rule.Describe(lang)
+		res.Next = dates
+	}
+	writeJSON(w, r, http.StatusOK, res)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+)
+
+// Router собирает все маршруты приложения
+func (h *TaskHandler) Router(pass string, keys *jwks.KeySet) http.Handler {
+	mux := http.NewServeMux()
+	auth := h.JWTMiddleware(pass, keys)
+	// write - аутентификация и Idempotency-Key для изменяющих запросов
+	write := func(next http.HandlerFunc) http.Handler {
+		return auth(h.idempotent(next))
+	}
+
+	mux.HandleFunc("GET /api/nextdate", h.NextDateHandler)
+	mux.HandleFunc("GET /api/repeat", h.DescribeRepeat)
+	mux.Handle("GET /.well-known/jwks.json", JWKSHandler(keys))
+	mux.Handle("POST /api/signin", h.Login(pass, keys))
+
+	mux.Handle("POST /api/task", write(h.AddTask))
+	mux.Handle("GET /api/task", auth(http.HandlerFunc(h.GetTask)))
+	mux.Handle("PUT /api/task", write(h.UpdateTask))
+	mux.Handle("DELETE /api/task", write(h.DeleteTask))
+	mux.Handle("POST /api/task/done", write(h.Done))
+	mux.Handle("POST /api/task/quick", write(h.QuickAdd))
+	mux.Handle("POST /api/task/quick/preview", write(h.QuickAddPreview))
+	mux.Handle("GET /api/tasks", auth(http.HandlerFunc(h.GetTasks)))
+	mux.Handle("POST /api/tasks/batch", write(h.Batch))
+
+	mux.Handle("GET /api/v2/tasks", auth(http.HandlerFunc(h.ListTasksV2)))
+	mux.Handle("POST /api/v2/tasks", write(h.CreateTaskV2))
+	mux.Handle("GET /api/v2/tasks/{id}", auth(http.HandlerFunc(h.GetTaskV2)))
+	mux.Handle("PUT /api/v2/tasks/{id}", write(h.ReplaceTaskV2))
+	mux.Handle("PATCH /api/v2/tasks/{id}", write(h.PatchTaskV2))
+	mux.Handle("DELETE /api/v2/tasks/{id}", write(h.DeleteTaskV2))
+	mux.Handle("POST /api/v2/tasks/{id}/done", write(h.DoneTaskV2))
+
+	// Ответы с токенами и секретами 2FA не сохраняются, поэтому Idempotency-Key здесь не поддерживается
+	if h.tokens != nil {
+		mux.Handle("POST /api/tokens", auth(http.HandlerFunc(h.CreateToken)))
+		mux.Handle("GET /api/tokens", auth(http.HandlerFunc(h.ListTokens)))
+		mux.Handle("DELETE /api/tokens", auth(http.HandlerFunc(h.RevokeToken)))
+	}
+
+	if h.filters != nil {
+		mux.Handle("POST /api/filters", write(h.CreateFilter))
+		mux.Handle("GET /api/filters", auth(http.HandlerFunc(h.ListFilters)))
+		mux.Handle("GET /api/filters/counts", auth(http.HandlerFunc(h.FilterCounts)))
+		mux.Handle("GET /api/filters/{id}", auth(http.HandlerFunc(h.GetFilter)))
+		mux.Handle("PUT /api/filters/{id}", write(h.UpdateFilter))
+		mux.Handle("DELETE /api/filters/{id}", write(h.DeleteFilter))
+		mux.Handle("GET /api/filters/{id}/tasks", auth(http.HandlerFunc(h.FilterTasks)))
+	}
+
+	if h.twoFactor != nil {
+		mux.Handle("POST /api/signin/2fa", h.LoginTwoFactor(keys))
+		mux.Handle("POST /api/2fa/enroll", auth(http.HandlerFunc(h.EnrollTwoFactor)))
+		mux.Handle("POST /api/2fa/confirm", auth(http.HandlerFunc(h.ConfirmTwoFactor)))
+		mux.Handle("POST /api/2fa/disable", auth(http.HandlerFunc(h.DisableTwoFactor)))
+	}
+
+	// Prometheus собирает метрики с API-токеном с правом read
+	if h.metrics != nil {
+		mux.Handle("GET /metrics", auth(h.metrics.Handler()))
+	}
+
+	if h.oidc != nil {
+		mux.Handle("GET /api/oidc/login", h.OIDCLogin(keys))
+		mux.Handle("GET /api/oidc/callback", h.OIDCCallback(keys))
+	}
+
+	return h.logged(h.localized(h.debugClockMiddleware(h.measured(mux))))
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+)
+
+// Управлять токенами можно только из сессии: токен не должен выпускать сам себя
+func sessionOnly(w http.ResponseWriter, r *http.Request) bool {
+	principal := PrincipalFromContext(r.Context())
+	if principal == nil || !principal.Session {
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrScope, nil))
+		return false
+	}
+	return true
+}
+
+func (h *TaskHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	if !sessionOnly(w, r) {
+		return
+	}
+	var req struct {
+		Name          string         `json:"name"`
+		Scopes        []domain.Scope `json:"scopes"`
+		ExpiresInDays int            `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, nil))
+		return
+	}
+
+	raw, token, cErr := h.tokens.Create(ctx, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(struct {
+		Token string           `json:"token"`
+		Info  *domain.APIToken `json:"info"`
+	}{
+		Token: raw,
+		Info:  token,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
+
+func (h *TaskHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	if !sessionOnly(w, r) {
+		return
+	}
+	tokens, cErr := h.tokens.List(ctx)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	err := json.NewEncoder(w).Encode(struct {
+		Tokens []*domain.APIToken `json:"tokens"`
+	}{
+		Tokens: tokens,
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
+
+func (h *TaskHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	if !sessionOnly(w, r) {
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrID, err))
+		return
+	}
+	if cErr := h.tokens.Revoke(ctx, id); cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	err = json.NewEncoder(w).Encode(struct{}{})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mfaTokenTTL time.Duration = 5 * time.Minute
+
+// generateMFAToken выдает токен, подтверждающий только первый фактор входа
+func generateMFAToken(keys *jwks.KeySet, account string) (string, error) {
+	return signToken(keys, typMFA, mfaTokenTTL, jwt.MapClaims{"sub": account})
+}
+
+func parseMFAToken(raw string, keys *jwks.KeySet) (string, error) {
+	claims, err := parseToken(keys, raw, typMFA)
+	if err != nil {
+		return "", err
+	}
+	account, _ := claims["sub"].(string)
+	if account == "" {
+		return "", domain.ErrUnauthorized
+	}
+	return account, nil
+}
+
+// LoginTwoFactor - второй шаг входа: код TOTP или код восстановления
+func (h *TaskHandler) LoginTwoFactor(keys *jwks.KeySet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MFAToken     string `json:"mfa_token"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, nil))
+			return
+		}
+		account, err := parseMFAToken(req.MFAToken, keys)
+		if err != nil {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrUnauthorized, err))
+			return
+		}
+		ip := clientIP(r)
+
+		if h.loginGuard != nil {
+			retryAfter, cErr := h.loginGuard.Check(r.Context(), ip, account)
+			if cErr != nil {
+				if cErr.Err == domain.ErrTooManyLogins {
+					h.countLogin(loginTOTP, loginLocked)
+					sendTooManyLogins(w, r, retryAfter)
+					return
+				}
+				sendJSONError(w, r, cErr)
+				return
+			}
+		}
+
+		var cErr *domain.CustomError
+		if req.RecoveryCode != "" {
+			cErr = h.twoFactor.Redeem(r.Context(), account, req.RecoveryCode)
+		} else {
+			cErr = h.twoFactor.Verify(r.Context(), account, req.Code)
+		}
+		if cErr != nil {
+			if cErr.Err == domain.ErrOTPCode {
+				h.loginFailed(w, r, loginTOTP, ip, account, domain.ErrOTPCode)
+				return
+			}
+			sendJSONError(w, r, cErr)
+			return
+		}
+
+		if h.loginGuard != nil {
+			if cErr = h.loginGuard.Succeed(r.Context(), ip, account); cErr != nil {
+				sendJSONError(w, r, cErr)
+				return
+			}
+		}
+		token, err := GenerateJWT(keys)
+		if err != nil {
+			sendJSONError(w, r, domain.NewCustomError(0, domain.ErrInternalServer, err))
+			return
+		}
+		h.countLogin(loginTOTP, loginSuccess)
+		err = json.NewEncoder(w).Encode(map[string]string{"token": token})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+		}
+	}
+}
+
+func (h *TaskHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	if !sessionOnly(w, r) {
+		return
+	}
+	enrollment, cErr := h.twoFactor.Enroll(ctx, DefaultAccount)
+	if cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	err := json.NewEncoder(w).Encode(enrollment)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
+
+func (h *TaskHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.twoFactorCodeAction(w, r, h.twoFactor.Confirm)
+}
+
+func (h *TaskHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	h.twoFactorCodeAction(w, r, h.twoFactor.Disable)
+}
+
+func (h *TaskHandler) twoFactorCodeAction(w http.ResponseWriter, r *http.Request,
+	action func(ctx context.Context, account, code string) *domain.CustomError) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	w.Header().Add("Content-Type", "application/json")
+	if !sessionOnly(w, r) {
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, r, domain.NewCustomError(0, domain.ErrBadJSON, nil))
+		return
+	}
+	if cErr := action(ctx, DefaultAccount, req.Code); cErr != nil {
+		sendJSONError(w, r, cErr)
+		return
+	}
+	err := json.NewEncoder(w).Encode(struct{}{})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+)
+
+const (
+	mergePatchType string = "application/merge-patch+json"
+	maxBodySize    int64  = 1 << 20
+)
+
+// envelopeV2 - формат успешного ответа v2: data и meta для списков.
+// Ошибки v2 отдаются в формате problem+json.
+type envelopeV2 struct {
+	Data any     `json:"data,omitempty"`
+	Meta *metaV2 `json:"meta,omitempty"`
+}
+
+type metaV2 struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func sendV2(w http.ResponseWriter, r *http.Request, status int, data any) {
+	sendV2Envelope(w, r, status, envelopeV2{Data: data})
+}
+
+func sendV2Envelope(w http.ResponseWriter, r *http.Request, status int, envelope envelopeV2) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if status == http.StatusNoContent {
+		return
+	}
+	err := json.NewEncoder(w).Encode(envelope)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error writing response", "error", err)
+	}
+}
+
+func sendV2Error(w http.ResponseWriter, r *http.Request, cErr *domain.CustomError) {
+	status := errorStatus(cErr)
+	logProblem(r, cErr, status)
+	writeProblem(w, r, newProblem(cErr, status, i18n.FromContext(r.Context())))
+}
+
+func pathID(r *http.Request) (int, *domain.CustomError) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		return 0, domain.NewCustomError(0, domain.ErrID, err)
+	}
+	return id, nil
+}
+
+func decodeV2(r *http.Request, dst any) *domain.CustomError {
+	if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+		return domain.NewCustomError(0, domain.ErrBadJSON, err)
+	}
+	return nil
+}
+
+func (h *TaskHandler) findByID(ctx context.Context, id int) (*domain.Task, *domain.CustomError) {
+	tasks, cErr := h.service.FindAll(ctx, &domain.Filter{ID: &id})
+	if cErr != nil {
+		return nil, cErr
+	}
+	return tasks[0], nil
+}
+
+// ListTasksV2 - GET /api/v2/tasks
+func (h *TaskHandler) ListTasksV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	filter, cErr := listFilter(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	page, cErr := h.service.FindPage(ctx, filter)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	sendV2Envelope(w, r, http.StatusOK, envelopeV2{Data: page.Tasks, Meta: &metaV2{NextCursor: page.NextCursor}})
+}
+
+// CreateTaskV2 - POST /api/v2/tasks
+func (h *TaskHandler) CreateTaskV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var task domain.Task
+	if cErr := decodeV2(r, &task); cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	task.ID = ""
+	id, cErr := h.service.Create(ctx, &task)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	task.ID = strconv.FormatInt(id, 10)
+	w.Header().Set("Location", "/api/v2/tasks/"+task.ID)
+	setETag(w, &task)
+	sendV2(w, r, http.StatusCreated, &task)
+}
+
+// GetTaskV2 - GET /api/v2/tasks/{id}
+func (h *TaskHandler) GetTaskV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, cErr := pathID(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	task, cErr := h.findByID(ctx, id)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	setETag(w, task)
+	sendV2(w, r, http.StatusOK, task)
+}
+
+// ReplaceTaskV2 - PUT /api/v2/tasks/{id}, заменяет задачу целиком
+func (h *TaskHandler) ReplaceTaskV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, cErr := pathID(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	version, cErr := ifMatch(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	var task domain.Task
+	if cErr = decodeV2(r, &task); cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	task.ID = strconv.Itoa(id)
+	task.Version = version
+	if cErr = h.service.Update(ctx, &task); cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	setETag(w, &task)
+	sendV2(w, r, http.StatusOK, &task)
+}
+
+// PatchTaskV2 - PATCH /api/v2/tasks/{id}, меняет только переданные поля.
+// С Content-Type application/merge-patch+json поле со значением null очищается,
+// в обычном JSON null означает "не менять".
+func (h *TaskHandler) PatchTaskV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, cErr := pathID(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	version, cErr := ifMatch(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	input, cErr := decodeTaskInput(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	task, cErr := h.service.Patch(ctx, id, input, version)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	setETag(w, task)
+	sendV2(w, r, http.StatusOK, task)
+}
+
+func decodeTaskInput(r *http.Request) (*domain.TaskInput, *domain.CustomError) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType {
+		var input domain.TaskInput
+		if cErr := decodeV2(r, &input); cErr != nil {
+			return nil, cErr
+		}
+		return &input, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrBadJSON, err)
+	}
+	input, err := domain.ParseMergePatch(body)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrBadJSON, err)
+	}
+	return input, nil
+}
+
+// DeleteTaskV2 - DELETE /api/v2/tasks/{id}
+func (h *TaskHandler) DeleteTaskV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, cErr := pathID(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	version, cErr := ifMatch(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	if cErr = h.service.Delete(ctx, id, version); cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	sendV2(w, r, http.StatusNoContent, nil)
+}
+
+// DoneTaskV2 - POST /api/v2/tasks/{id}/done. Повторяющаяся задача возвращается
+// с новой датой, разовая удаляется и ответ приходит без тела.
+func (h *TaskHandler) DoneTaskV2(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id, cErr := pathID(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	version, cErr := ifMatch(r)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	task, cErr := h.service.Done(ctx, &domain.Filter{ID: &id}, version)
+	if cErr != nil {
+		sendV2Error(w, r, cErr)
+		return
+	}
+	if task == nil {
+		sendV2(w, r, http.StatusNoContent, nil)
+		return
+	}
+	setETag(w, task)
+	sendV2(w, r, http.StatusOK, task)
+}
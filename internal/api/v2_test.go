@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/agidelle/TODO_web_v2/internal/service"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// v2Client отправляет запросы в роутер с задачами в памяти от имени сессии
+type v2Client struct {
+	t       *testing.T
+	router  http.Handler
+	session string
+}
+
+func newV2Client(t *testing.T, opts ...HandlerOption) *v2Client {
+	t.Helper()
+	keys, err := jwks.NewHMACKeySet("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := GenerateJWT(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	s := service.NewService(memory.NewTaskStore(), service.WithClock(service.FixedClock(now)))
+	return &v2Client{t: t, router: NewHandler(s, opts...).Router("pass", keys), session: session}
+}
+
+func (c *v2Client) do(method, target, body string, header ...string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	r.Header.Set("Authorization", "Bearer "+c.session)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	c.router.ServeHTTP(w, r)
+	return w
+}
+
+func TestV2CreateGetDelete(t *testing.T) {
+	c := newV2Client(t)
+
+	w := c.do(http.MethodPost, "/api/v2/tasks", `{"title":"Отчет","date":"20240201"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("создание: статус %d, тело %s", w.Code, w.Body)
+	}
+	var created struct {
+		Data domain.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	location := w.Header().Get("Location")
+	if created.Data.ID == "" || location != "/api/v2/tasks/"+created.Data.ID {
+		t.Errorf("Location = %q, id = %q", location, created.Data.ID)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Error("создание без ETag")
+	}
+
+	w = c.do(http.MethodGet, location, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("чтение: статус %d", w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag чтения %s, при создании %s", got, etag)
+	}
+
+	w = c.do(http.MethodDelete, location, "", "If-Match", etag)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("удаление: статус %d, тело %s", w.Code, w.Body)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("тело ответа 204: %s", w.Body)
+	}
+
+	w = c.do(http.MethodGet, location, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("чтение удаленной задачи: статус %d", w.Code)
+	}
+}
+
+func TestV2Problems(t *testing.T) {
+	c := newV2Client(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		status  int
+		code    string
+		fields  []string
+		headers []string
+	}{
+		{"неизвестный id", http.MethodGet, "/api/v2/tasks/999", "", http.StatusNotFound, "task_not_found", nil, nil},
+		{"удаление неизвестного id", http.MethodDelete, "/api/v2/tasks/999", "", http.StatusNotFound, "task_not_found", nil, []string{"If-Match", "*"}},
+		{"одно нарушение", http.MethodPost, "/api/v2/tasks", `{"title":""}`, http.StatusBadRequest, domain.ErrBadTitle.Code, []string{"/title"}, nil},
+		{"несколько нарушений", http.MethodPost, "/api/v2/tasks", `{"title":"","date":"завтра","repeat":"x"}`,
+			http.StatusBadRequest, domain.ErrValidation.Code, []string{"/title", "/date", "/repeat"}, nil},
+		{"некорректный JSON", http.MethodPost, "/api/v2/tasks", `{"title":`, http.StatusBadRequest, domain.ErrBadJSON.Code, nil, nil},
+		{"merge patch с неверным типом", http.MethodPatch, "/api/v2/tasks/1", `{"title":5}`, http.StatusBadRequest, domain.ErrBadJSON.Code, nil,
+			[]string{"If-Match", "*", "Content-Type", mergePatchType}},
+		{"без If-Match", http.MethodDelete, "/api/v2/tasks/1", "", http.StatusPreconditionRequired, domain.ErrNoPrecondition.Code, nil, nil},
+	}
+	for _, tt := range tests {
+		w := c.do(tt.method, tt.target, tt.body, tt.headers...)
+		if w.Code != tt.status {
+			t.Errorf("%s: статус %d, ожидалось %d", tt.name, w.Code, tt.status)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != problemType {
+			t.Errorf("%s: Content-Type = %q", tt.name, ct)
+		}
+		var p problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.Status != tt.status || p.Code != tt.code || p.Detail == "" {
+			t.Errorf("%s: problem = %+v", tt.name, p)
+		}
+		if len(tt.fields) == 0 {
+			continue
+		}
+		var pointers []string
+		for _, field := range p.Errors {
+			pointers = append(pointers, field.Pointer)
+		}
+		if strings.Join(pointers, " ") != strings.Join(tt.fields, " ") {
+			t.Errorf("%s: errors = %v, ожидалось %v", tt.name, pointers, tt.fields)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package domain
+
+// Операции пакетного запроса
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDone   = "done"
+	BatchDelete = "delete"
+	BatchMove   = "move"
+)
+
+// BatchOp - одна операция пакета. Task задает поля для create и update
+// (в update меняются только переданные поля), Date - новую дату для move.
+// Version, если задана, проверяется так же, как If-Match.
+type BatchOp struct {
+	Op      string     `json:"op"`
+	ID      string     `json:"id,omitempty"`
+	Task    *TaskInput `json:"task,omitempty"`
+	Date    string     `json:"date,omitempty"`
+	Version int64      `json:"version,omitempty"`
+}
+
+// BatchResult - итог операции: Task после изменения (nil для delete и
+// выполненной разовой задачи) или ошибка
+type BatchResult struct {
+	Index int
+	Op    string
+	Task  *Task
+	Err   *CustomError
+}
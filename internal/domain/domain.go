@@ -1,6 +1,10 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
 
 type Task struct {
 	ID      string `json:"id,omitempty"`
@@ -8,28 +12,115 @@ type Task struct {
 	Title   string `json:"title,omitempty"`
 	Comment string `json:"comment,omitempty"`
 	Repeat  string `json:"repeat,omitempty"`
+	// Tags хранятся без # в нижнем регистре
+	Tags     []string `json:"tags,omitempty"`
+	Priority int      `json:"priority,omitempty"`
+	// Version увеличивается при каждой записи, передается клиенту через ETag
+	Version int64 `json:"-"`
+	// Match заполняется только в результатах полнотекстового поиска
+	Match *SearchMatch `json:"match,omitempty"`
 }
 
+// SearchMatch - релевантность задачи и фрагменты текста с подсвеченными
+// совпадениями. Фрагменты - HTML: текст задачи экранирован, совпадения
+// обрамлены <mark></mark>.
+type SearchMatch struct {
+	Rank    float32 `json:"rank"`
+	Title   string  `json:"title,omitempty"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// Приоритет задачи: чем больше, тем важнее
+const (
+	PriorityNone   = 0
+	PriorityLow    = 1
+	PriorityMedium = 2
+	PriorityHigh   = 3
+)
+
 type TaskInput struct {
-	ID      *string `json:"id,omitempty"`
-	Date    *string `json:"date,omitempty"`
-	Title   *string `json:"title,omitempty"`
-	Comment *string `json:"comment,omitempty"`
-	Repeat  *string `json:"repeat,omitempty"`
+	ID       *string   `json:"id,omitempty"`
+	Date     *string   `json:"date,omitempty"`
+	Title    *string   `json:"title,omitempty"`
+	Comment  *string   `json:"comment,omitempty"`
+	Repeat   *string   `json:"repeat,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+	Priority *int      `json:"priority,omitempty"`
 }
 
+// Filter - условия выборки задач. Теги json описывают поля, которые
+// сохраняются в именованных фильтрах; остальные задаются на каждый запрос.
 type Filter struct {
-	ID         *int
-	SearchTerm string
-	Date       string
-	Limit      int
+	ID         *int   `json:"-"`
+	SearchTerm string `json:"search,omitempty"`
+	Date       string `json:"date,omitempty"`
+	// From и To - границы диапазона дат включительно, формат 20060102.
+	// Period - именованный период (today, week, overdue, 7d), сервис
+	// переводит его в From/To.
+	From     string `json:"from,omitempty"`
+	To       string `json:"to,omitempty"`
+	Period   string `json:"period,omitempty"`
+	NoRepeat bool   `json:"norepeat,omitempty"`
+	Sort     Sort   `json:"sort,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+	// Cursor - непрозрачный курсор из next_cursor предыдущей страницы,
+	// After - он же в разобранном виде для хранилища
+	Cursor string  `json:"-"`
+	After  *Cursor `json:"-"`
+	// Query - разобранный поисковый запрос, заменяет SearchTerm
+	Query *Query `json:"-"`
+	// ForUpdate блокирует найденные строки до конца транзакции (см. WithTx)
+	ForUpdate bool `json:"-"`
+}
+
+// Sort - порядок списка задач; "-" в начале означает обратный порядок.
+// Пустой порядок - по дате, а при полнотекстовом поиске по релевантности.
+type Sort string
+
+const (
+	SortDate      Sort = "date"
+	SortDateDesc  Sort = "-date"
+	SortTitle     Sort = "title"
+	SortTitleDesc Sort = "-title"
+)
+
+func (s Sort) Valid() bool {
+	switch s {
+	case "", SortDate, SortDateDesc, SortTitle, SortTitleDesc:
+		return true
+	}
+	return false
+}
+
+// Cursor - позиция в списке задач: дата, id и ключ сортировки последней задачи страницы
+type Cursor struct {
+	Date string `json:"d"`
+	ID   int    `json:"i"`
+	// Rank задан, если страница отсортирована по релевантности
+	Rank *float32 `json:"r,omitempty"`
+	// Title задан при сортировке по заголовку
+	Title *string `json:"t,omitempty"`
+	Sort  Sort    `json:"s,omitempty"`
+}
+
+type TaskPage struct {
+	Tasks      []*Task `json:"tasks"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 type TaskRepository interface {
 	FindTask(ctx context.Context, filter *Filter) ([]*Task, error)
 	CreateTask(ctx context.Context, task *Task) (int64, error)
+	// UpdateTask и DeleteTask при ненулевой версии меняют задачу, только если
+	// версия в БД совпадает, иначе возвращают ErrVersion
 	UpdateTask(ctx context.Context, task *Task) error
-	DeleteTask(ctx context.Context, id *int) error
+	DeleteTask(ctx context.Context, id *int, version int64) error
+	// CountTasks считает задачи по каждому фильтру без учета курсора и лимита.
+	// Все фильтры считаются за один проход по задачам.
+	CountTasks(ctx context.Context, filters []*Filter) ([]int, error)
+	// WithTx выполняет fn в одной транзакции: если fn вернула ошибку, все ее
+	// изменения откатываются. Вложенный WithTx откатывает только свою часть.
+	WithTx(ctx context.Context, fn func(repo TaskRepository) error) error
 	CloseDB()
 }
 
@@ -61,6 +152,12 @@ func (r *TaskInput) TaskToOptions() []TaskOption {
 	if r.Repeat != nil {
 		opts = append(opts, WithRepeat(*r.Repeat))
 	}
+	if r.Tags != nil {
+		opts = append(opts, WithTags(*r.Tags))
+	}
+	if r.Priority != nil {
+		opts = append(opts, WithPriority(*r.Priority))
+	}
 	return opts
 }
 
@@ -93,3 +190,70 @@ func WithRepeat(repeat string) TaskOption {
 		task.Repeat = repeat
 	}
 }
+
+func WithTags(tags []string) TaskOption {
+	return func(task *Task) {
+		task.Tags = tags
+	}
+}
+
+func WithPriority(priority int) TaskOption {
+	return func(task *Task) {
+		task.Priority = priority
+	}
+}
+
+// ParseMergePatch разбирает тело JSON Merge Patch (RFC 7396): отсутствующее
+// поле не меняется, а null очищает его. Очищенное поле становится пустой
+// строкой (пустым списком тегов, нулевым приоритетом), дальше к нему
+// применяются обычные правила задачи.
+func ParseMergePatch(data []byte) (*TaskInput, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	input := &TaskInput{}
+	fields := map[string]**string{
+		"date":    &input.Date,
+		"title":   &input.Title,
+		"comment": &input.Comment,
+		"repeat":  &input.Repeat,
+	}
+	for name, value := range raw {
+		switch name {
+		case "tags":
+			tags := []string{}
+			if err := json.Unmarshal(value, &tags); err != nil {
+				return nil, fmt.Errorf("поле %s: %w", name, err)
+			}
+			if tags == nil {
+				tags = []string{}
+			}
+			input.Tags = &tags
+			continue
+		case "priority":
+			var priority *int
+			if err := json.Unmarshal(value, &priority); err != nil {
+				return nil, fmt.Errorf("поле %s: %w", name, err)
+			}
+			if priority == nil {
+				priority = new(int)
+			}
+			input.Priority = priority
+			continue
+		}
+		dst, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var v *string
+		if err := json.Unmarshal(value, &v); err != nil {
+			return nil, fmt.Errorf("поле %s: %w", name, err)
+		}
+		if v == nil {
+			v = new(string)
+		}
+		*dst = v
+	}
+	return input, nil
+}
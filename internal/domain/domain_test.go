@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseMergePatch(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+
+	tests := []struct {
+		body string
+		want TaskInput
+	}{
+		// Отсутствующие поля остаются nil и не меняются
+		{`{}`, TaskInput{}},
+		{`{"title":"Отчет"}`, TaskInput{Title: str("Отчет")}},
+		// null очищает поле
+		{`{"comment":null,"repeat":null}`, TaskInput{Comment: str(""), Repeat: str("")}},
+		{`{"priority":null}`, TaskInput{Priority: num(0)}},
+		{`{"priority":2,"date":"20240201"}`, TaskInput{Priority: num(2), Date: str("20240201")}},
+		// Неизвестные поля пропускаются
+		{`{"id":"5","done":true}`, TaskInput{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseMergePatch([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: %v", tt.body, err)
+			continue
+		}
+		if !equalPtr(got.Title, tt.want.Title) || !equalPtr(got.Date, tt.want.Date) ||
+			!equalPtr(got.Comment, tt.want.Comment) || !equalPtr(got.Repeat, tt.want.Repeat) ||
+			!equalPtr(got.Priority, tt.want.Priority) || got.Tags != nil || got.ID != nil {
+			t.Errorf("%s: %+v, ожидалось %+v", tt.body, got, tt.want)
+		}
+	}
+
+	for body, want := range map[string][]string{
+		`{"tags":null}`:      {},
+		`{"tags":[]}`:        {},
+		`{"tags":["a","b"]}`: {"a", "b"},
+	} {
+		got, err := ParseMergePatch([]byte(body))
+		if err != nil {
+			t.Errorf("%s: %v", body, err)
+			continue
+		}
+		if got.Tags == nil || !slices.Equal(*got.Tags, want) || *got.Tags == nil {
+			t.Errorf("%s: теги %v, ожидалось %v", body, got.Tags, want)
+		}
+	}
+}
+
+func TestParseMergePatchRejectsWrongTypes(t *testing.T) {
+	for _, body := range []string{
+		`{"title":5}`,
+		`{"date":true}`,
+		`{"comment":["a"]}`,
+		`{"priority":"high"}`,
+		`{"priority":1.5}`,
+		`{"tags":"a"}`,
+		`{"tags":[1]}`,
+		`[]`,
+		`{"title":`,
+	} {
+		if input, err := ParseMergePatch([]byte(body)); err == nil {
+			t.Errorf("%s: принято %+v", body, input)
+		}
+	}
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -1,18 +1,154 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind - класс ошибки. По нему API выбирает HTTP-статус, поэтому сервису
+// и хранилищу не нужно знать о протоколе.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindNotFound
+	KindConflict
+	KindPrecondition
+	KindPreconditionRequired
+	KindUnprocessable
+	KindDependency
+	KindUnauthorized
+	KindForbidden
+	KindTooManyRequests
+	KindUpstream
+)
+
+// Error - ошибка предметной области. Code - стабильный машиночитаемый код,
+// он не меняется при изменении текста Message.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Field - JSON Pointer поля тела запроса, к которому относится ошибка
+	Field string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(kind Kind, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func newFieldError(field, code, message string) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Field: field}
+}
+
+// Message - пояснение к ошибке с параметрами. Text - готовый русский текст,
+// Code - ключ каталога i18n, в шаблон перевода подставляются Args.
+type Message struct {
+	Code string
+	Text string
+	Args []any
+}
+
+func NewMessage(code, format string, args ...any) *Message {
+	return &Message{Code: code, Text: fmt.Sprintf(format, args...), Args: args}
+}
+
+func (m *Message) Error() string {
+	return m.Text
+}
+
+// Unwrap возвращает ошибки среди параметров, чтобы работали errors.Is и errors.As
+func (m *Message) Unwrap() []error {
+	var errs []error
+	for _, arg := range m.Args {
+		if err, ok := arg.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
 
 var (
-	ErrID             = errors.New("некорректный id")
-	ErrBadTitle       = errors.New("не указан заголовок задачи")
-	ErrDate           = errors.New("неправильный формат даты")
-	ErrInternalServer = errors.New("внутренняя ошибка сервера")
+	ErrID              = newError(KindValidation, "invalid_id", "некорректный id")
+	ErrValidation      = newError(KindValidation, "validation_failed", "запрос содержит ошибки в нескольких полях")
+	ErrTitleLength     = newFieldError("/title", "title_too_long", "заголовок задачи слишком длинный")
+	ErrCommentLength   = newFieldError("/comment", "comment_too_long", "комментарий слишком длинный")
+	ErrBadTitle        = newFieldError("/title", "title_required", "не указан заголовок задачи")
+	ErrDate            = newFieldError("/date", "invalid_date", "неправильный формат даты")
+	ErrRepeat          = newFieldError("/repeat", "invalid_repeat", "некорректное правило повторения")
+	ErrRepeatFormat    = newFieldError("/repeat", "repeat_format", "неверный формат правила повторения")
+	ErrRepeatDays      = newFieldError("/repeat", "repeat_days", "не более 400 дней")
+	ErrRepeatWeekdays  = newFieldError("/repeat", "repeat_weekdays", "неверный формат дней недели")
+	ErrRepeatMonthDays = newFieldError("/repeat", "repeat_month_days", "неверный формат дней месяца")
+	ErrRepeatMonths    = newFieldError("/repeat", "repeat_months", "неверный формат месяцев")
+	ErrRepeatNoDate    = newFieldError("/repeat", "repeat_no_date", "не удалось найти подходящую дату")
+	ErrBadJSON         = newError(KindValidation, "invalid_json", "ошибка десериализации JSON")
+	ErrParam           = newError(KindValidation, "invalid_parameter", "некорректное значение параметра")
+	ErrInternalServer  = newError(KindInternal, "internal_error", "внутренняя ошибка сервера")
+	ErrNotFound        = newError(KindNotFound, "task_not_found", "задача не найдена")
+	ErrVersion         = newError(KindPrecondition, "version_mismatch", "задача была изменена другим запросом")
+	ErrNoPrecondition  = newError(KindPreconditionRequired, "precondition_required", "не указан заголовок If-Match")
+	ErrCursor          = newError(KindValidation, "invalid_cursor", "некорректный курсор страницы")
+	ErrLimit           = newError(KindValidation, "invalid_limit", "некорректный размер страницы")
+	ErrQuery           = newError(KindValidation, "invalid_query", "некорректный поисковый запрос")
+	ErrPeriod          = newError(KindValidation, "invalid_period", "некорректный период")
+	ErrSort            = newError(KindValidation, "invalid_sort", "некорректная сортировка")
+	ErrTag             = newFieldError("/tags", "invalid_tag", "некорректный тег")
+	ErrPriority        = newFieldError("/priority", "invalid_priority", "приоритет должен быть от 0 до 3")
+	ErrQuickAdd        = newFieldError("/text", "invalid_quick_add", "не удалось разобрать текст задачи")
+	ErrBatchOp         = newError(KindValidation, "invalid_batch_op", "неизвестная операция")
+	ErrBatchSize       = newFieldError("/operations", "invalid_batch_size", "некорректный размер пакета")
+	ErrBatchAborted    = newError(KindDependency, "batch_aborted", "операция отменена, так как пакет не выполнен целиком")
+	ErrIdempotencyKey  = newError(KindValidation, "invalid_idempotency_key", "некорректный заголовок Idempotency-Key")
+	ErrIdempotencyUsed = newError(KindUnprocessable, "idempotency_key_reused", "Idempotency-Key уже использован для другого запроса")
+	ErrIdempotencyBusy = newError(KindConflict, "idempotency_in_progress", "запрос с этим Idempotency-Key еще выполняется")
+	ErrFilterName      = newFieldError("/name", "filter_name_required", "не указано имя фильтра")
+	ErrFilterNotFound  = newError(KindNotFound, "filter_not_found", "сохраненный фильтр не найден")
+	ErrFilterExists    = newError(KindConflict, "filter_exists", "фильтр с таким именем уже существует")
+	ErrUnauthorized    = newError(KindUnauthorized, "unauthorized", "не авторизован")
+	ErrToken           = newError(KindUnauthorized, "invalid_token", "недействительный токен")
+	ErrScope           = newError(KindForbidden, "insufficient_scope", "недостаточно прав")
+	ErrTokenName       = newFieldError("/name", "token_name_required", "не указано имя токена")
+	ErrTokenNotFound   = newError(KindNotFound, "token_not_found", "токен не найден")
+	ErrTokenScope      = newFieldError("/scopes", "invalid_scope", "неизвестная область доступа токена")
+	ErrPassword        = newError(KindUnauthorized, "invalid_password", "неправильный пароль")
+	ErrTooManyLogins   = newError(KindTooManyRequests, "too_many_logins", "слишком много попыток входа, попробуйте позже")
+	ErrOTPCode         = newError(KindUnauthorized, "invalid_otp_code", "неверный код подтверждения")
+	ErrOTPNotEnrolled  = newError(KindConflict, "otp_not_enrolled", "двухфакторная аутентификация не подключена")
+	ErrOTPEnrolled     = newError(KindConflict, "otp_enrolled", "двухфакторная аутентификация уже подключена")
+	ErrOIDC            = newError(KindUpstream, "oidc_error", "ошибка входа через OIDC-провайдера")
+	ErrOIDCIdentity    = newError(KindForbidden, "oidc_identity_not_linked", "учетная запись провайдера не сопоставлена с локальной")
 )
 
+// KindOf возвращает класс ошибки; ошибки вне домена считаются внутренними
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+// FieldError - нарушение, относящееся к конкретному полю запроса
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Code    string `json:"code"`
+	Detail  string `json:"detail"`
+}
+
 type CustomError struct {
+	// Code - HTTP-статус, если он зависит от места ошибки; обычно 0,
+	// и статус выбирается по классу Err
 	Code       int
 	Err        error
 	ErrStorage error
+	// Fields - подробности по полям, если нарушений несколько
+	Fields []FieldError
 }
 
 func NewCustomError(code int, err error, errStorage error) *CustomError {
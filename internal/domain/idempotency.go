@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// IdempotencyRecord - сохраненный результат запроса с заголовком Idempotency-Key.
+// Пока запрос выполняется, Completed = false, ответа еще нет, а ExpiresAt -
+// короткий срок аренды ключа. После ответа ExpiresAt продлевается.
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	Completed   bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey занимает ключ, если его нет или срок записи истек,
+	// и возвращает nil. Иначе возвращает существующую запись.
+	ReserveIdempotencyKey(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, record *IdempotencyRecord) error
+	// ReleaseIdempotencyKey освобождает ключ, чтобы запрос можно было повторить
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
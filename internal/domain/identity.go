@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Identity связывает внешнюю учетную запись OIDC-провайдера с локальной
+type Identity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email,omitempty"`
+	Account   string    `json:"account"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type IdentityRepository interface {
+	FindIdentity(ctx context.Context, issuer, subject string) (*Identity, error)
+	SaveIdentity(ctx context.Context, identity *Identity) error
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// LoginAttempt - запись аудита попытки входа
+type LoginAttempt struct {
+	Account string    `json:"account"`
+	IP      string    `json:"ip"`
+	Success bool      `json:"success"`
+	At      time.Time `json:"at"`
+}
+
+// LoginState - счетчик неудачных попыток для ключа (IP или учетной записи)
+type LoginState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+type LoginAttemptStore interface {
+	GetLoginState(ctx context.Context, key string) (*LoginState, error)
+	// IncrementLoginFailures атомарно учитывает ошибку входа для ключа и
+	// возвращает новое состояние. Если последняя ошибка была раньше
+	// now-window, счет начинается заново.
+	IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginState, error)
+	// LockLogin продлевает блокировку ключа до until, не сокращая уже назначенную
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ResetLoginState(ctx context.Context, key string) error
+	RecordLoginAttempt(ctx context.Context, attempt *LoginAttempt) error
+}
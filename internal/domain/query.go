@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+)
+
+type QueryField string
+
+const (
+	FieldText    QueryField = "text" // слово или фраза без поля: ищется в заголовке и комментарии
+	FieldTitle   QueryField = "title"
+	FieldComment QueryField = "comment"
+	FieldTag     QueryField = "tag"
+	FieldDue     QueryField = "due"
+	FieldRepeat  QueryField = "repeat"
+	FieldStatus  QueryField = "status"
+)
+
+type QueryOp string
+
+const (
+	OpContains QueryOp = "~"
+	OpEq       QueryOp = "="
+	OpLt       QueryOp = "<"
+	OpLte      QueryOp = "<="
+	OpGt       QueryOp = ">"
+	OpGte      QueryOp = ">="
+	// OpBetween - диапазон дат "from..to", любая граница может быть пустой
+	OpBetween QueryOp = ".."
+)
+
+// Значения repeat: и status:
+const (
+	RepeatNone    = "none"
+	StatusOpen    = "open"
+	StatusOverdue = "overdue"
+)
+
+// QueryTerm - одно условие запроса. Даты в Value хранятся в формате 20060102,
+// диапазон (OpBetween) - как "20060102..20060102".
+type QueryTerm struct {
+	Field  QueryField `json:"field"`
+	Op     QueryOp    `json:"op"`
+	Value  string     `json:"value"`
+	Phrase bool       `json:"phrase,omitempty"`
+	Negate bool       `json:"negate,omitempty"`
+}
+
+// Query - разобранный поисковый запрос: все условия должны выполняться одновременно.
+// Today нужен для status: и задается сервисом перед выполнением запроса.
+type Query struct {
+	Terms []QueryTerm `json:"terms"`
+	Today string      `json:"-"`
+}
+
+// Match вычисляет запрос над задачей для хранилищ без SQL. Условия с полями
+// вычисляются так же, как в SQL-хранилище. Слова и фразы без поля Match ищет
+// только как подстроку, а SQL-хранилище находит еще словоформы и опечатки.
+func (q *Query) Match(task *Task) bool {
+	for _, term := range q.Terms {
+		ok := term.match(task, q.Today)
+		if term.Negate {
+			ok = !ok
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// TextTerms возвращает условия полнотекстового поиска без отрицания.
+// Если они есть, результаты сортируются по релевантности.
+func (q *Query) TextTerms() []QueryTerm {
+	var terms []QueryTerm
+	for _, term := range q.Terms {
+		if term.Field == FieldText && !term.Negate {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func (t QueryTerm) match(task *Task, today string) bool {
+	switch t.Field {
+	case FieldText:
+		return containsFold(task.Title, t.Value) || containsFold(task.Comment, t.Value)
+	case FieldTitle:
+		return containsFold(task.Title, t.Value)
+	case FieldComment:
+		return containsFold(task.Comment, t.Value)
+	case FieldTag:
+		for _, tag := range task.Tags {
+			if strings.EqualFold(tag, t.Value) {
+				return true
+			}
+		}
+		return TagPattern(t.Value).MatchString(task.Title + " " + task.Comment)
+	case FieldDue:
+		return compareDates(task.Date, t.Op, t.Value)
+	case FieldRepeat:
+		return RepeatKind(task.Repeat) == t.Value
+	case FieldStatus:
+		if t.Value == StatusOverdue {
+			return task.Date < today
+		}
+		return task.Date >= today
+	}
+	return false
+}
+
+// RepeatKind возвращает вид правила повторения: d, w, m, y или none
+func RepeatKind(repeat string) string {
+	if repeat == "" {
+		return RepeatNone
+	}
+	kind, _, _ := strings.Cut(repeat, " ")
+	return kind
+}
+
+// TagPattern - регулярное выражение для хэштега #tag в тексте
+func TagPattern(tag string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(^|\s)#` + regexp.QuoteMeta(tag) + `($|[^\p{L}\p{N}_-])`)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// DateRange возвращает границы диапазона условия с OpBetween
+func (t QueryTerm) DateRange() (from, to string) {
+	from, to, _ = strings.Cut(t.Value, string(OpBetween))
+	return from, to
+}
+
+func compareDates(date string, op QueryOp, value string) bool {
+	switch op {
+	case OpBetween:
+		from, to := QueryTerm{Value: value}.DateRange()
+		return (from == "" || date >= from) && (to == "" || date <= to)
+	case OpLt:
+		return date < value
+	case OpLte:
+		return date <= value
+	case OpGt:
+		return date > value
+	case OpGte:
+		return date >= value
+	default:
+		return date == value
+	}
+}
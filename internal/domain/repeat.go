@@ -0,0 +1,224 @@
+package domain
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды правил повторения
+const (
+	RepeatDays    = "d"
+	RepeatYearly  = "y"
+	RepeatWeekly  = "w"
+	RepeatMonthly = "m"
+)
+
+// Максимальный интервал правила d
+const MaxRepeatDays = 400
+
+// RepeatRule - разобранное правило повторения задачи:
+//
+//	d N          - через N дней (1..400)
+//	y            - ежегодно
+//	w 1,3        - по дням недели, 1 - понедельник, 7 - воскресенье
+//	m 1,-1 [1,6] - по дням месяца (-1 - последний, -2 - предпоследний),
+//	               при необходимости только в указанных месяцах
+type RepeatRule struct {
+	Kind      string
+	Interval  int
+	Weekdays  []int
+	MonthDays []int
+	// Months пустой, если подходит любой месяц
+	Months []int
+}
+
+// ParseRepeat разбирает правило повторения. Для пустой строки возвращает
+// nil: задача не повторяется.
+func ParseRepeat(repeat string) (*RepeatRule, error) {
+	if repeat == "" {
+		return nil, nil
+	}
+	kind, args, hasArgs := strings.Cut(repeat, " ")
+	if !hasArgs && kind != RepeatYearly {
+		return nil, ErrRepeatFormat
+	}
+	rule := &RepeatRule{Kind: kind}
+	switch kind {
+	case RepeatYearly:
+		if repeat != RepeatYearly {
+			return nil, ErrRepeatFormat
+		}
+	case RepeatDays:
+		days, err := strconv.Atoi(args)
+		if err != nil || days <= 0 || days > MaxRepeatDays {
+			return nil, ErrRepeatDays
+		}
+		rule.Interval = days
+	case RepeatWeekly:
+		days, ok := parseRepeatList(args, func(n int) bool { return n >= 1 && n <= 7 })
+		if !ok {
+			return nil, ErrRepeatWeekdays
+		}
+		rule.Weekdays = days
+	case RepeatMonthly:
+		parts := strings.Split(args, " ")
+		if len(parts) > 2 {
+			return nil, ErrRepeatFormat
+		}
+		days, ok := parseRepeatList(parts[0], func(n int) bool { return n >= -2 && n != 0 && n <= 31 })
+		if !ok {
+			return nil, ErrRepeatMonthDays
+		}
+		rule.MonthDays = days
+		if len(parts) == 2 {
+			months, ok := parseRepeatList(parts[1], func(n int) bool { return n >= 1 && n <= 12 })
+			if !ok {
+				return nil, ErrRepeatMonths
+			}
+			rule.Months = months
+		}
+	default:
+		return nil, ErrRepeatFormat
+	}
+	return rule, nil
+}
+
+// parseRepeatList разбирает список чисел через запятую
+func parseRepeatList(list string, valid func(int) bool) ([]int, bool) {
+	var res []int
+	for _, item := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(item)
+		if err != nil || !valid(n) {
+			return nil, false
+		}
+		res = append(res, n)
+	}
+	return res, true
+}
+
+// String возвращает правило в каноническом виде: числа без ведущих нулей,
+// без повторов и по порядку (дни месяца -2 и -1 - в конце)
+func (r *RepeatRule) String() string {
+	if r == nil {
+		return ""
+	}
+	switch r.Kind {
+	case RepeatDays:
+		return RepeatDays + " " + strconv.Itoa(r.Interval)
+	case RepeatWeekly:
+		return RepeatWeekly + " " + joinInts(sortedUnique(r.Weekdays))
+	case RepeatMonthly:
+		res := RepeatMonthly + " " + joinInts(sortedMonthDays(r.MonthDays))
+		if len(r.Months) > 0 {
+			res += " " + joinInts(sortedUnique(r.Months))
+		}
+		return res
+	}
+	return r.Kind
+}
+
+// Next возвращает ближайшую дату повторения после after для задачи с датой start
+func (r *RepeatRule) Next(start, after time.Time) (time.Time, error) {
+	switch r.Kind {
+	case RepeatDays:
+		if after.After(start) {
+			totalDays := int(after.Sub(start).Hours() / 24)
+			steps := totalDays/r.Interval + 1
+			return start.AddDate(0, 0, steps*r.Interval), nil
+		}
+		return start.AddDate(0, 0, r.Interval), nil
+	case RepeatYearly:
+		if start.After(after) {
+			return start.AddDate(1, 0, 0), nil
+		}
+		next := start.AddDate(after.Year()-start.Year(), 0, 0)
+		if !next.After(after) {
+			next = next.AddDate(1, 0, 0)
+		}
+		return next, nil
+	case RepeatWeekly:
+		return nextWeekday(after, r.Weekdays)
+	case RepeatMonthly:
+		return nextMonthDay(start, after, r.MonthDays, r.Months)
+	}
+	return time.Time{}, ErrRepeatFormat
+}
+
+// nextWeekday ищет ближайший после now день из списка (1 - понедельник, 7 - воскресенье)
+func nextWeekday(now time.Time, weekdays []int) (time.Time, error) {
+	current := int(now.Weekday())
+	if current == 0 {
+		current = 7 // Преобразуем Sunday в 7 для удобства
+	}
+	//Подходящий день может выпасть на сегодняшнее число,
+	//поэтому проверяем сразу и следующую неделю
+	for i := 0; i < 14; i++ {
+		day := (current+i-1)%7 + 1
+		if slices.Contains(weekdays, day) {
+			if candidate := now.AddDate(0, 0, i); candidate.After(now) {
+				return candidate, nil
+			}
+		}
+	}
+	return time.Time{}, ErrRepeatNoDate
+}
+
+// Сколько лет просматривать в поиске дня месяца: 29 февраля бывает
+// и через 8 лет
+const monthDaySearchYears = 8
+
+// nextMonthDay ищет минимальную дату не раньше start и позже now
+func nextMonthDay(start, now time.Time, days, months []int) (time.Time, error) {
+	var best time.Time
+	from := max(start.Year(), now.Year())
+	for year := from; year <= from+monthDaySearchYears && best.IsZero(); year++ {
+		for month := 1; month <= 12; month++ {
+			if len(months) > 0 && !slices.Contains(months, month) {
+				continue
+			}
+			lastDay := time.Date(year, time.Month(month+1), 0, 0, 0, 0, 0, time.UTC).Day()
+			for _, day := range days {
+				if day < 0 {
+					day = lastDay + day + 1 // -1 - последний день, -2 - предпоследний
+				}
+				if day < 1 || day > lastDay {
+					continue
+				}
+				date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+				if !date.Before(start) && date.After(now) && (best.IsZero() || date.Before(best)) {
+					best = date
+				}
+			}
+		}
+	}
+	if best.IsZero() {
+		return time.Time{}, ErrRepeatNoDate
+	}
+	return best, nil
+}
+
+func sortedUnique(nums []int) []int {
+	res := slices.Clone(nums)
+	slices.Sort(res)
+	return slices.Compact(res)
+}
+
+// sortedMonthDays упорядочивает дни месяца: сначала числа, затем -2 и -1
+func sortedMonthDays(days []int) []int {
+	res := sortedUnique(days)
+	i := 0
+	for i < len(res) && res[i] < 0 {
+		i++
+	}
+	return slices.Concat(res[i:], res[:i])
+}
+
+func joinInts(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,188 @@
+package domain
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Фиксированные часы: все свойства проверяются относительно одной даты,
+// чтобы результат не зависел от дня запуска
+var fixedNow = time.Date(2024, time.January, 26, 0, 0, 0, 0, time.UTC)
+
+const propertyRuns = 2000
+
+// randomRule возвращает случайное корректное правило
+func randomRule(rnd *rand.Rand) *RepeatRule {
+	switch rnd.IntN(4) {
+	case 0:
+		return &RepeatRule{Kind: RepeatDays, Interval: 1 + rnd.IntN(MaxRepeatDays)}
+	case 1:
+		return &RepeatRule{Kind: RepeatYearly}
+	case 2:
+		return &RepeatRule{Kind: RepeatWeekly, Weekdays: randomList(rnd, 1, 7)}
+	}
+	rule := &RepeatRule{Kind: RepeatMonthly}
+	for _, day := range randomList(rnd, 1, 33) {
+		if day > 31 {
+			day = 31 - day // 32 -> -1, 33 -> -2
+		}
+		rule.MonthDays = append(rule.MonthDays, day)
+	}
+	if rnd.IntN(2) == 0 {
+		rule.Months = randomList(rnd, 1, 12)
+	}
+	return rule
+}
+
+func randomList(rnd *rand.Rand, lo, hi int) []int {
+	res := make([]int, 1+rnd.IntN(3))
+	for i := range res {
+		res[i] = lo + rnd.IntN(hi-lo+1)
+	}
+	return res
+}
+
+// randomDate возвращает дату в пределах нескольких лет от fixedNow
+func randomDate(rnd *rand.Rand) time.Time {
+	return fixedNow.AddDate(0, 0, rnd.IntN(6*365)-3*365)
+}
+
+// matches проверяет, что date - одна из дат повторения задачи с датой start
+func matches(r *RepeatRule, start, date time.Time) bool {
+	switch r.Kind {
+	case RepeatDays:
+		days := int(date.Sub(start).Hours() / 24)
+		return days > 0 && days%r.Interval == 0
+	case RepeatYearly:
+		for years := 1; years <= date.Year()-start.Year(); years++ {
+			if start.AddDate(years, 0, 0).Equal(date) {
+				return true
+			}
+		}
+		return false
+	case RepeatWeekly:
+		weekday := int(date.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		return slices.Contains(r.Weekdays, weekday)
+	case RepeatMonthly:
+		if date.Before(start) {
+			return false
+		}
+		if len(r.Months) > 0 && !slices.Contains(r.Months, int(date.Month())) {
+			return false
+		}
+		lastDay := time.Date(date.Year(), date.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for _, day := range r.MonthDays {
+			if day < 0 {
+				day = lastDay + day + 1
+			}
+			if day == date.Day() {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func TestRepeatRuleNextProperties(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for range propertyRuns {
+		rule := randomRule(rnd)
+		start := randomDate(rnd)
+		next, err := rule.Next(start, fixedNow)
+		if err != nil {
+			// Без даты остаются только правила на несуществующие дни,
+			// например 30 и 31 февраля
+			if rule.Kind == RepeatMonthly && err == ErrRepeatNoDate {
+				continue
+			}
+			t.Fatalf("%q от %s: %v", rule, start.Format("20060102"), err)
+		}
+		if !next.After(fixedNow) {
+			t.Fatalf("%q от %s: %s не позже %s", rule, start.Format("20060102"),
+				next.Format("20060102"), fixedNow.Format("20060102"))
+		}
+		if !matches(rule, start, next) {
+			t.Fatalf("%q от %s: %s не соответствует правилу", rule, start.Format("20060102"), next.Format("20060102"))
+		}
+		for day := fixedNow.AddDate(0, 0, 1); day.Before(next); day = day.AddDate(0, 0, 1) {
+			if matches(rule, start, day) {
+				t.Fatalf("%q от %s: %s раньше найденной %s", rule, start.Format("20060102"),
+					day.Format("20060102"), next.Format("20060102"))
+			}
+		}
+	}
+}
+
+func TestRepeatRuleStringRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(3, 4))
+	for range propertyRuns {
+		rule := randomRule(rnd)
+		canonical := rule.String()
+		parsed, err := ParseRepeat(canonical)
+		if err != nil {
+			t.Fatalf("ParseRepeat(%q): %v", canonical, err)
+		}
+		if parsed.String() != canonical {
+			t.Fatalf("ParseRepeat(%q).String() = %q", canonical, parsed.String())
+		}
+		start := randomDate(rnd)
+		want, wantErr := rule.Next(start, fixedNow)
+		got, gotErr := parsed.Next(start, fixedNow)
+		if !got.Equal(want) || gotErr != wantErr {
+			t.Fatalf("%q: каноническая форма дает %s, исходная %s", canonical, got, want)
+		}
+	}
+}
+
+func TestNextMonthDayEdges(t *testing.T) {
+	date := func(s string) time.Time {
+		d, err := time.Parse("20060102", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		name   string
+		start  string
+		now    string
+		days   []int
+		months []int
+		want   string
+	}{
+		{"последний день через границу месяца", "20240131", "20240131", []int{-1}, nil, "20240229"},
+		{"предпоследний день февраля", "20230101", "20230215", []int{-2}, nil, "20230227"},
+		{"31 число пропускает короткие месяцы", "20240401", "20240401", []int{31}, nil, "20240531"},
+		{"переход через год", "20241231", "20241231", []int{1}, nil, "20250101"},
+		{"29 февраля в високосный год", "20250101", "20250101", []int{29}, []int{2}, "20280229"},
+		{"дата начала в будущем", "20240601", "20240126", []int{1}, nil, "20240601"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextMonthDay(date(tt.start), date(tt.now), tt.days, tt.months)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Format("20060102") != tt.want {
+				t.Errorf("получено %s, ожидалось %s", got.Format("20060102"), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextWeekdaySkipsToday(t *testing.T) {
+	// 26.01.2024 - пятница; пятница по правилу - следующая
+	got, err := nextWeekday(fixedNow, []int{5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fixedNow.AddDate(0, 0, 7); !got.Equal(want) {
+		t.Errorf("получено %s, ожидалось %s", got.Format("20060102"), want.Format("20060102"))
+	}
+}
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/agidelle/TODO_web_v2/internal/i18n"
+)
+
+var (
+	enWeekdays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+	enMonths   = []string{"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"}
+	// Дни недели в дательном падеже: "по понедельникам"
+	ruWeekdays = []string{"понедельникам", "вторникам", "средам", "четвергам", "пятницам", "субботам", "воскресеньям"}
+	// Месяцы в родительном падеже: "15-го числа марта"
+	ruMonths = []string{"января", "февраля", "марта", "апреля", "мая", "июня",
+		"июля", "августа", "сентября", "октября", "ноября", "декабря"}
+)
+
+// Describe возвращает описание правила для людей, например
+// "every 2nd and 15th of March and June". Неподдерживаемый язык - русский.
+func (r *RepeatRule) Describe(lang i18n.Lang) string {
+	if lang == i18n.En {
+		return r.describeEn()
+	}
+	return r.describeRu()
+}
+
+func (r *RepeatRule) describeEn() string {
+	switch r.Kind {
+	case RepeatDays:
+		if r.Interval == 1 {
+			return "every day"
+		}
+		return "every " + strconv.Itoa(r.Interval) + " days"
+	case RepeatYearly:
+		return "every year"
+	case RepeatWeekly:
+		return "every " + joinWords(names(sortedUnique(r.Weekdays), enWeekdays), "and")
+	case RepeatMonthly:
+		var days []string
+		for _, day := range sortedMonthDays(r.MonthDays) {
+			switch day {
+			case -1:
+				days = append(days, "last day")
+			case -2:
+				days = append(days, "second-to-last day")
+			default:
+				days = append(days, enOrdinal(day))
+			}
+		}
+		scope := "the month"
+		if len(r.Months) > 0 {
+			scope = joinWords(names(sortedUnique(r.Months), enMonths), "and")
+		}
+		return "every " + joinWords(days, "and") + " of " + scope
+	}
+	return ""
+}
+
+func (r *RepeatRule) describeRu() string {
+	switch r.Kind {
+	case RepeatDays:
+		n := r.Interval
+		switch {
+		case n == 1:
+			return "каждый день"
+		case n%10 == 1 && n%100 != 11:
+			return "каждый " + strconv.Itoa(n) + " день"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "каждые " + strconv.Itoa(n) + " дня"
+		}
+		return "каждые " + strconv.Itoa(n) + " дней"
+	case RepeatYearly:
+		return "каждый год"
+	case RepeatWeekly:
+		return "по " + joinWords(names(sortedUnique(r.Weekdays), ruWeekdays), "и")
+	case RepeatMonthly:
+		var numbers, last []string
+		for _, day := range sortedMonthDays(r.MonthDays) {
+			switch day {
+			case -1:
+				last = append(last, "последнего")
+			case -2:
+				last = append(last, "предпоследнего")
+			default:
+				numbers = append(numbers, strconv.Itoa(day)+"-го")
+			}
+		}
+		var parts []string
+		if len(numbers) > 0 {
+			parts = append(parts, joinWords(numbers, "и")+" числа")
+		}
+		if len(last) > 0 {
+			parts = append(parts, joinWords(last, "и")+" дня")
+		}
+		scope := "каждого месяца"
+		if len(r.Months) > 0 {
+			scope = joinWords(names(sortedUnique(r.Months), ruMonths), "и")
+		}
+		return strings.Join(parts, " и ") + " " + scope
+	}
+	return ""
+}
+
+// names переводит номера, начиная с 1, в названия
+func names(nums []int, list []string) []string {
+	res := make([]string, len(nums))
+	for i, n := range nums {
+		res[i] = list[n-1]
+	}
+	return res
+}
+
+// joinWords соединяет слова как в тексте: "a, b and c"
+func joinWords(words []string, and string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " " + and + " " + words[len(words)-1]
+}
+
+func enOrdinal(n int) string {
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// SavedFilter - именованный фильтр ("умный список"). Filter хранится в
+// сериализованном виде, период вроде today вычисляется при каждом запуске.
+type SavedFilter struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Filter    Filter    `json:"filter"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FilterCount - число задач в сохраненном фильтре для бейджей в боковой панели
+type FilterCount struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Методы возвращают ErrFilterNotFound, если фильтра нет,
+// и ErrFilterExists при повторяющемся имени
+type SavedFilterRepository interface {
+	CreateSavedFilter(ctx context.Context, filter *SavedFilter) (int64, error)
+	GetSavedFilter(ctx context.Context, id int64) (*SavedFilter, error)
+	ListSavedFilters(ctx context.Context) ([]*SavedFilter, error)
+	UpdateSavedFilter(ctx context.Context, filter *SavedFilter) error
+	DeleteSavedFilter(ctx context.Context, id int64) error
+}
@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+)
+
+// APIToken - долгоживущий персональный токен для скриптов и автоматизации.
+// В БД хранится только хэш, сам токен показывается один раз при создании.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []Scope    `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (t *APIToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		// write подразумевает read
+		if s == scope || (s == ScopeWrite && scope == ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+type TokenRepository interface {
+	CreateToken(ctx context.Context, token *APIToken) (int64, error)
+	FindTokenByHash(ctx context.Context, hash string) (*APIToken, error)
+	ListTokens(ctx context.Context) ([]*APIToken, error)
+	RevokeToken(ctx context.Context, id int64) error
+	TouchToken(ctx context.Context, id int64, usedAt time.Time) error
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// TwoFactor - настройки TOTP для учетной записи. Пока Enabled = false,
+// подключение не подтверждено кодом и при входе не требуется.
+type TwoFactor struct {
+	Account       string
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string // sha256 от неиспользованных кодов восстановления
+	LastStep      int64    // последний принятый шаг TOTP, защита от повтора кода
+	CreatedAt     time.Time
+}
+
+// Enrollment возвращается один раз при подключении 2FA
+type Enrollment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorRepository interface {
+	GetTwoFactor(ctx context.Context, account string) (*TwoFactor, error)
+	SaveTwoFactor(ctx context.Context, tf *TwoFactor) error
+	DeleteTwoFactor(ctx context.Context, account string) error
+	// AdvanceTOTPStep запоминает принятый шаг, только если он больше последнего.
+	// false означает, что шаг уже использован, например параллельным входом.
+	AdvanceTOTPStep(ctx context.Context, account string, step int64) (bool, error)
+	// UseRecoveryCode удаляет код восстановления по хэшу. false - кода нет
+	// или его уже погасил другой запрос.
+	UseRecoveryCode(ctx context.Context, account, hash string) (bool, error)
+}
@@ -0,0 +1,86 @@
+package i18n
+
+var en = map[string]string{
+	"validation_failed": "request has errors in several fields",
+	"title_too_long":    "task title is too long",
+	"comment_too_long":  "comment is too long",
+	"invalid_id":        "invalid id",
+	"title_required":    "task title is required",
+	"invalid_date":      "invalid date format",
+	"invalid_repeat":    "invalid repeat rule",
+	"repeat_format":     "invalid repeat rule format",
+	"repeat_days":       "no more than 400 days",
+	"repeat_weekdays":   "invalid days of the week",
+	"repeat_month_days": "invalid days of the month",
+	"repeat_months":     "invalid months",
+	"repeat_no_date":    "no matching date found",
+	"nextdate_failed":   "failed to calculate the next date",
+	"repeat_none":       "does not repeat",
+
+	"invalid_json":          "malformed JSON",
+	"invalid_parameter":     "invalid parameter value",
+	"internal_error":        "internal server error",
+	"task_not_found":        "task not found",
+	"version_mismatch":      "task was modified by another request",
+	"precondition_required": "If-Match header is required",
+	"invalid_cursor":        "invalid page cursor",
+	"invalid_limit":         "invalid page size",
+	"invalid_query":         "invalid search query",
+	"invalid_period":        "invalid period",
+	"invalid_sort":          "invalid sort order",
+	"invalid_tag":           "invalid tag",
+	"invalid_priority":      "priority must be between 0 and 3",
+	"invalid_quick_add":     "could not parse task text",
+	"sort_options":          "%q, available: date, -date, title, -title",
+	"period_options":        "%q, available: today, week, overdue, Nd",
+	"debug_clock":           "expected a date 20060102, an RFC 3339 time or an offset like +72h",
+	"debug_clock_header":    "%s: %s",
+
+	"query_position":       "%s (position %d)",
+	"query_value_required": "no value for %q",
+	"query_tag":            "tag %q may contain only letters, digits, _ and -",
+	"query_date":           "invalid date %q, expected YYYY-MM-DD, DD.MM.YYYY or a period today, week, overdue, Nd",
+	"query_repeat":         "unknown repeat kind %q, available: d, w, m, y, none",
+	"query_status":         "unknown status %q, available: open, overdue",
+	"query_field":          "unknown field %q, available: title, comment, tag, due, repeat, status; quote text that contains a colon",
+	"query_unclosed_quote": "unclosed quote",
+	"query_empty_phrase":   "empty quoted phrase",
+
+	"quick_add_phrase":    "%q: %s",
+	"quick_add_month_day": "day of month %q must be between 1 and 31",
+	"quick_add_date":      "invalid date %q",
+	"quick_add_interval":  "interval must be between 1 and %d days",
+	"quick_add_no_day":    "the month has no day %d",
+
+	"invalid_batch_op":   "unknown operation",
+	"invalid_batch_size": "invalid batch size",
+	"batch_aborted":      "operation cancelled because the batch did not complete",
+	"batch_size_range":   "from 1 to %d operations",
+	"batch_update_task":  "update requires the task field",
+	"batch_op_options":   "%q, available: create, update, done, delete, move",
+	"cursor_sort":        "the cursor was issued for a different sort order",
+	"cursor_position":    "the cursor contains an invalid position",
+
+	"invalid_idempotency_key": "invalid Idempotency-Key header",
+	"idempotency_key_reused":  "Idempotency-Key was already used for a different request",
+	"idempotency_in_progress": "a request with this Idempotency-Key is still in progress",
+
+	"filter_name_required": "filter name is required",
+	"filter_not_found":     "saved filter not found",
+	"filter_exists":        "a filter with this name already exists",
+
+	"unauthorized":             "unauthorized",
+	"invalid_token":            "invalid token",
+	"insufficient_scope":       "insufficient scope",
+	"token_name_required":      "token name is required",
+	"token_not_found":          "token not found",
+	"invalid_scope":            "unknown token scope",
+	"invalid_password":         "wrong password",
+	"too_many_logins":          "too many login attempts, try again later",
+	"invalid_otp_code":         "invalid verification code",
+	"otp_not_enrolled":         "two-factor authentication is not enabled",
+	"otp_enrolled":             "two-factor authentication is already enabled",
+	"oidc_error":               "OIDC provider sign-in failed",
+	"oidc_no_id_token":         "the provider did not return an id_token",
+	"oidc_identity_not_linked": "provider account is not linked to a local account",
+}
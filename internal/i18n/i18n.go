@@ -0,0 +1,116 @@
+// Package i18n переводит сообщения API. Ключ сообщения - стабильный код
+// ошибки домена; русский текст задан в самом домене и служит запасным
+// вариантом, поэтому каталог нужен только для остальных языков.
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type Lang string
+
+const (
+	Ru Lang = "ru"
+	En Lang = "en"
+)
+
+// Default - язык, на котором написаны сообщения домена
+const Default = Ru
+
+// Каталоги сообщений; новый язык добавляется отдельным файлом с картой
+// код -> текст и записью здесь
+var catalogs = map[Lang]map[string]string{
+	Ru: ru,
+	En: en,
+}
+
+// Parse возвращает поддерживаемый язык по тегу вида en, en-US или RU
+func Parse(tag string) (Lang, bool) {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	lang := Lang(strings.ToLower(primary))
+	_, ok := catalogs[lang]
+	return lang, ok
+}
+
+// Negotiate выбирает язык ответа: явное предпочтение пользователя, затем
+// самый приоритетный поддерживаемый язык из Accept-Language, иначе fallback
+func Negotiate(preference, acceptLanguage string, fallback Lang) Lang {
+	if lang, ok := Parse(preference); ok {
+		return lang
+	}
+	type candidate struct {
+		lang Lang
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if lang, ok := Parse(tag); ok && q > 0 {
+			candidates = append(candidates, candidate{lang, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return fallback
+	}
+	// Порядок в заголовке сохраняется для языков с одинаковым q
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	return candidates[0].lang
+}
+
+// Translate возвращает сообщение с кодом code на языке lang. Если перевода
+// нет, используется русский каталог, а затем fallback.
+func Translate(lang Lang, code, fallback string) string {
+	if msg, ok := catalogs[lang][code]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[Default][code]; ok {
+		return msg
+	}
+	return fallback
+}
+
+// Format переводит сообщение с параметрами: шаблон fmt из каталога
+// заполняется args. Без перевода возвращается готовый текст fallback.
+func Format(lang Lang, code, fallback string, args ...any) string {
+	if format, ok := catalogs[lang][code]; ok {
+		return fmt.Sprintf(format, args...)
+	}
+	if format, ok := catalogs[Default][code]; ok {
+		return fmt.Sprintf(format, args...)
+	}
+	return fallback
+}
+
+type langKey struct{}
+
+func WithLang(ctx context.Context, lang Lang) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// FromContext возвращает язык запроса или Default
+func FromContext(ctx context.Context) Lang {
+	if lang, ok := ctx.Value(langKey{}).(Lang); ok {
+		return lang
+	}
+	return Default
+}
@@ -0,0 +1,50 @@
+package i18n
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		preference string
+		accept     string
+		want       Lang
+	}{
+		{"", "", Ru},
+		{"", "en", En},
+		{"", "en-US,en;q=0.9", En},
+		{"", "ru-RU, en;q=0.8", Ru},
+		// Выигрывает больший q, а не порядок в заголовке
+		{"", "en;q=0.3, ru;q=0.7", Ru},
+		{"", "ru;q=0.5, en", En},
+		// При равном q - порядок в заголовке
+		{"", "en;q=0.5, ru;q=0.5", En},
+		// q=0 означает "не подходит"
+		{"", "en;q=0", Ru},
+		{"", "en;q=0, ru;q=0.1", Ru},
+		// Неподдерживаемые языки и испорченные q пропускаются
+		{"", "de, fr;q=0.9, en;q=0.1", En},
+		{"", "en;q=abc, ru;q=0.2", Ru},
+		{"", "*", Ru},
+		// Явный выбор пользователя важнее заголовка, если язык поддерживается
+		{"en", "ru", En},
+		{"de", "en", En},
+		{"EN-gb", "", En},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.preference, tt.accept, Ru); got != tt.want {
+			t.Errorf("Negotiate(%q, %q) = %s, ожидалось %s", tt.preference, tt.accept, got, tt.want)
+		}
+	}
+	if got := Negotiate("", "de", En); got != En {
+		t.Errorf("без подходящего языка = %s, ожидался fallback", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := Format(En, "query_position", "не используется", "unclosed quote", 3); got != "unclosed quote (position 3)" {
+		t.Errorf("Format(en) = %q", got)
+	}
+	// Русского шаблона нет в каталоге: возвращается готовый текст
+	if got := Format(Ru, "query_position", "не закрыта кавычка (позиция 3)", "x", 3); got != "не закрыта кавычка (позиция 3)" {
+		t.Errorf("Format(ru) = %q", got)
+	}
+}
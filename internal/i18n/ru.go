@@ -0,0 +1,7 @@
+package i18n
+
+// Сообщения API, которых нет среди ошибок домена
+var ru = map[string]string{
+	"nextdate_failed": "ошибка вычисления следующей даты",
+	"repeat_none":     "не повторяется",
+}
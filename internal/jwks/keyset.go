@@ -0,0 +1,253 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey - ключ набора. Private == nil у выведенных из оборота ключей:
+// ими только проверяются ранее выданные токены.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private any
+	Public  any
+}
+
+// KeySet подписывает токены активным ключом и проверяет их любым ключом набора.
+// Ротация: новый ключ кладется в каталог и становится активным, старый остается
+// в каталоге (можно только открытую часть), пока не истекут выданные им токены.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewHMACKeySet - набор из одного общего секрета HS256 (TODO_JWTSECRET)
+func NewHMACKeySet(secret string) (*KeySet, error) {
+	if secret == "" {
+		return nil, errors.New("отсутствие jwt-key")
+	}
+	key := hmacKey(secret)
+	return &KeySet{active: key, keys: map[string]*SigningKey{key.ID: key}}, nil
+}
+
+func hmacKey(secret string) *SigningKey {
+	return &SigningKey{ID: "", Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}
+}
+
+// LoadKeySet читает PEM-файлы *.pem из каталога; kid - имя файла без расширения.
+// Активным становится activeKID, а если он не задан - последний по имени файл
+// с закрытым ключом. legacySecret, если задан, принимается только для проверки,
+// чтобы сессии, выданные до перехода на асимметричные ключи, оставались валидными.
+func LoadKeySet(dir, activeKID, legacySecret string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	set := &KeySet{keys: make(map[string]*SigningKey)}
+	var lastPrivate *SigningKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		key, err := parsePEMKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		set.keys[kid] = key
+		if key.Private != nil {
+			lastPrivate = key
+		}
+	}
+
+	if activeKID != "" {
+		key, ok := set.keys[activeKID]
+		if !ok || key.Private == nil {
+			return nil, fmt.Errorf("нет закрытого ключа для kid %q", activeKID)
+		}
+		set.active = key
+	} else {
+		set.active = lastPrivate
+	}
+	if set.active == nil {
+		return nil, fmt.Errorf("в каталоге %s нет закрытых ключей", dir)
+	}
+
+	if legacySecret != "" {
+		set.keys[""] = hmacKey(legacySecret)
+	}
+	return set, nil
+}
+
+func parsePEMKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("не найден PEM-блок")
+	}
+
+	var private, public any
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("неподдерживаемый PEM-блок %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if private != nil {
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("неподдерживаемый тип закрытого ключа")
+		}
+		public = signer.Public()
+	}
+
+	method, err := methodFor(public)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: kid, Method: method, Private: private, Public: public}, nil
+}
+
+func methodFor(public any) (jwt.SigningMethod, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+	}
+	return nil, errors.New("неподдерживаемый тип ключа")
+}
+
+// Sign подписывает claims активным ключом и указывает его kid в заголовке
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	if s.active.ID != "" {
+		token.Header["kid"] = s.active.ID
+	}
+	signed, err := token.SignedString(s.active.Private)
+	if err != nil {
+		return "", errors.New("ошибка подписи jwt")
+	}
+	return signed, nil
+}
+
+// Keyfunc выбирает ключ проверки по kid и не допускает подмены алгоритма
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("неправильный метод шифрования token: %v", token.Header["alg"])
+	}
+	return key.Public, nil
+}
+
+// Parse проверяет подпись и стандартные claims токена; opts добавляют
+// проверки, например издателя и аудитории
+func (s *KeySet) Parse(raw string, claims jwt.Claims, opts ...jwt.ParserOption) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(raw, claims, s.Keyfunc, append(opts, jwt.WithValidMethods(s.methods()))...)
+}
+
+func (s *KeySet) methods() []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, key := range s.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			res = append(res, alg)
+		}
+	}
+	return res
+}
+
+// Public возвращает открытые ключи для публикации в JWKS. Общий секрет HS256
+// в JWKS не попадает.
+func (s *KeySet) Public() Set {
+	set := Set{Keys: make([]Key, 0, len(s.keys))}
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		key := s.keys[id]
+		jwk, err := KeyFromPublic(id, key.Method.Alg(), key.Public)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// KeyFromPublic кодирует открытый ключ в JWK
+func KeyFromPublic(kid, alg string, public any) (Key, error) {
+	key := Key{Kid: kid, Use: "sig", Alg: alg}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = encodeInt(pub.N, 0)
+		key.E = encodeInt(big.NewInt(int64(pub.E)), 0)
+	case *ecdsa.PublicKey:
+		key.Kty = "EC"
+		key.Crv = pub.Curve.Params().Name
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		key.X = encodeInt(pub.X, size)
+		key.Y = encodeInt(pub.Y, size)
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return Key{}, errors.New("ключ нельзя опубликовать в JWKS")
+	}
+	return key, nil
+}
+
+// encodeInt дополняет координаты EC нулями до размера кривой, как требует RFC 7518
+func encodeInt(n *big.Int, size int) string {
+	b := n.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
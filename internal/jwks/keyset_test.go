@@ -0,0 +1,291 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey кладет в каталог PEM-файл kid.pem: закрытый ключ в PKCS #8
+// или, если public, только его открытую часть
+func writeKey(t *testing.T, dir, kid string, key crypto.Signer, public bool) {
+	t.Helper()
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	var err error
+	if public {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(key.Public())
+	} else {
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newEd25519(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newECDSA(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func claims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+// signedWith возвращает kid и alg из заголовка токена, подписанного набором
+func signedWith(t *testing.T, set *KeySet) (token, kid, alg string) {
+	t.Helper()
+	token, err := set.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ = parsed.Header["kid"].(string)
+	return token, kid, parsed.Method.Alg()
+}
+
+func TestLoadKeySetActiveKey(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01", newEd25519(t), false)
+	writeKey(t, dir, "2024-02", newECDSA(t), false)
+	// Последний по имени файл без закрытой части активным стать не может
+	writeKey(t, dir, "2024-03", newEd25519(t), true)
+
+	tests := []struct {
+		active  string
+		wantKid string
+		wantAlg string
+		wantErr bool
+	}{
+		{"", "2024-02", "ES256", false},
+		{"2024-01", "2024-01", "EdDSA", false},
+		{"2024-02", "2024-02", "ES256", false},
+		{"2024-03", "", "", true},
+		{"2023-12", "", "", true},
+	}
+	for _, tt := range tests {
+		set, err := LoadKeySet(dir, tt.active, "")
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("LoadKeySet(active=%q): ожидалась ошибка", tt.active)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LoadKeySet(active=%q): %v", tt.active, err)
+			continue
+		}
+		token, kid, alg := signedWith(t, set)
+		if kid != tt.wantKid || alg != tt.wantAlg {
+			t.Errorf("active=%q: подписано kid=%q alg=%s, ожидалось kid=%q alg=%s", tt.active, kid, alg, tt.wantKid, tt.wantAlg)
+		}
+		if _, err := set.Parse(token, &jwt.RegisteredClaims{}); err != nil {
+			t.Errorf("active=%q: свой токен не прошел проверку: %v", tt.active, err)
+		}
+	}
+}
+
+func TestLoadKeySetErrors(t *testing.T) {
+	empty := t.TempDir()
+	if _, err := LoadKeySet(empty, "", ""); err == nil {
+		t.Error("пустой каталог: ожидалась ошибка")
+	}
+
+	onlyPublic := t.TempDir()
+	writeKey(t, onlyPublic, "pub", newEd25519(t), true)
+	if _, err := LoadKeySet(onlyPublic, "", "secret"); err == nil {
+		t.Error("каталог без закрытых ключей: ожидалась ошибка")
+	}
+
+	broken := t.TempDir()
+	if err := os.WriteFile(filepath.Join(broken, "bad.pem"), []byte("не PEM"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeySet(broken, "", ""); err == nil {
+		t.Error("файл без PEM-блока: ожидалась ошибка")
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, newKey := newEd25519(t), newECDSA(t)
+
+	// До ротации в каталоге только старый ключ
+	before := t.TempDir()
+	writeKey(t, before, "old", oldKey, false)
+	oldSet, err := LoadKeySet(before, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _, _ := signedWith(t, oldSet)
+
+	// Период перекрытия: новый ключ активен, старый остался открытой частью
+	overlap := t.TempDir()
+	writeKey(t, overlap, "new", newKey, false)
+	writeKey(t, overlap, "old", oldKey, true)
+	set, err := LoadKeySet(overlap, "new", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, kid, _ := signedWith(t, set)
+	if kid != "new" {
+		t.Errorf("после ротации подписано kid=%q, ожидалось new", kid)
+	}
+	for name, token := range map[string]string{"старый": oldToken, "новый": newToken} {
+		if _, err := set.Parse(token, &jwt.RegisteredClaims{}); err != nil {
+			t.Errorf("%s токен в период перекрытия: %v", name, err)
+		}
+	}
+
+	// Старый ключ убран из каталога: выданные им токены больше не принимаются
+	after := t.TempDir()
+	writeKey(t, after, "new", newKey, false)
+	set, err = LoadKeySet(after, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Parse(oldToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("токен выведенного ключа принят после перекрытия")
+	}
+	if _, err := set.Parse(newToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("токен активного ключа: %v", err)
+	}
+}
+
+func TestKeySetLegacyHMAC(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "current", newEd25519(t), false)
+
+	legacy, err := NewHMACKeySet("legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyToken, kid, alg := signedWith(t, legacy)
+	if kid != "" || alg != "HS256" {
+		t.Fatalf("токен общего секрета: kid=%q alg=%s", kid, alg)
+	}
+
+	set, err := LoadKeySet(dir, "", "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Parse(legacyToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("токен общего секрета не принят: %v", err)
+	}
+	// Общий секрет служит только для проверки, подписывает активный ключ
+	if _, _, alg := signedWith(t, set); alg != "EdDSA" {
+		t.Errorf("подписано %s, ожидалось EdDSA", alg)
+	}
+	// В JWKS общий секрет не публикуется
+	for _, key := range set.Public().Keys {
+		if key.Kid == "" {
+			t.Errorf("в JWKS попал ключ без kid: %+v", key)
+		}
+	}
+
+	// Без секрета старые токены не принимаются
+	strict, err := LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strict.Parse(legacyToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("токен общего секрета принят без TODO_JWTSECRET")
+	}
+
+	// HS256 с kid асимметричного ключа - подмена алгоритма
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	forged.Header["kid"] = "current"
+	raw, err := forged.SignedString([]byte("legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Parse(raw, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("принят HS256 с kid ключа EdDSA")
+	}
+}
+
+func TestKeyFromPublicRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey := newECDSA(t)
+	edKey := newEd25519(t)
+
+	tests := []struct {
+		kid    string
+		alg    string
+		public crypto.PublicKey
+		kty    string
+	}{
+		{"rsa", "RS256", rsaKey.Public(), "RSA"},
+		{"ec", "ES256", ecKey.Public(), "EC"},
+		{"ed", "EdDSA", edKey.Public(), "OKP"},
+	}
+	var set Set
+	for _, tt := range tests {
+		key, err := KeyFromPublic(tt.kid, tt.alg, tt.public)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.kid, err)
+		}
+		if key.Kty != tt.kty || key.Kid != tt.kid || key.Alg != tt.alg || key.Use != "sig" {
+			t.Errorf("%s: JWK = %+v", tt.kid, key)
+		}
+		set.Keys = append(set.Keys, key)
+	}
+	// Координаты P-256 всегда 32 байта, даже с ведущими нулями
+	for _, coord := range []string{set.Keys[1].X, set.Keys[1].Y} {
+		if b, _ := base64.RawURLEncoding.DecodeString(coord); len(b) != 32 {
+			t.Errorf("координата EC %d байт, ожидалось 32", len(b))
+		}
+	}
+	if _, err := KeyFromPublic("hmac", "HS256", []byte("secret")); err == nil {
+		t.Error("общий секрет закодирован в JWK")
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, ok := keys[tt.kid].(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !got.Equal(tt.public) {
+			t.Errorf("%s: после разбора JWKS получен другой ключ", tt.kid)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserveRequestMethodLabel(t *testing.T) {
+	m := New()
+	for _, method := range []string{"GET", "PATCH", "FOO", "BAR", "get"} {
+		m.ObserveRequest(method, "unmatched", 405, time.Millisecond)
+	}
+
+	families, err := m.registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, family := range families {
+		if family.GetName() != "todo_http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "method" {
+					got[label.GetValue()] += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	want := map[string]float64{"GET": 1, "PATCH": 1, "OTHER": 3}
+	if len(got) != len(want) {
+		t.Fatalf("методы в метках: %v, ожидалось %v", got, want)
+	}
+	for method, count := range want {
+		if got[method] != count {
+			t.Errorf("%s = %v, ожидалось %v", method, got[method], count)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector снимает статистику пула соединений в момент опроса
+type poolCollector struct {
+	stat func() *pgxpool.Stat
+
+	acquired    *prometheus.Desc
+	idle        *prometheus.Desc
+	total       *prometheus.Desc
+	max         *prometheus.Desc
+	acquires    *prometheus.Desc
+	waited      *prometheus.Desc
+	waitSeconds *prometheus.Desc
+}
+
+// NewPoolCollector собирает статистику pgxpool. Текущего числа ожидающих
+// pgxpool не дает, поэтому ожидание видно по счетчику получений соединения,
+// которым пришлось ждать, и по суммарному времени ожидания.
+func NewPoolCollector(stat func() *pgxpool.Stat) prometheus.Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+	return &poolCollector{
+		stat:        stat,
+		acquired:    desc("acquired_connections", "Соединения, занятые запросами."),
+		idle:        desc("idle_connections", "Свободные соединения."),
+		total:       desc("total_connections", "Все открытые соединения."),
+		max:         desc("max_connections", "Максимальный размер пула."),
+		acquires:    desc("acquires_total", "Число получений соединения из пула."),
+		waited:      desc("empty_acquires_total", "Число получений соединения, которым пришлось ждать свободного."),
+		waitSeconds: desc("empty_acquire_wait_seconds_total", "Суммарное время ожидания свободного соединения."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquires
+	ch <- c.waited
+	ch <- c.waitSeconds
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stat()
+	if s == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waited, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitSeconds, prometheus.CounterValue, s.EmptyAcquireWaitTime().Seconds())
+}
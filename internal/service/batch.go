@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// maxBatchOps - ограничение размера пакета, чтобы транзакция не держала блокировки долго
+const maxBatchOps int = 100
+
+// Batch выполняет операции в одной транзакции. При atomic любая ошибка
+// откатывает весь пакет, иначе откатывается только неудачная операция,
+// а остальные фиксируются. Возвращает результат каждой операции и признак
+// того, что изменения зафиксированы.
+func (s *TaskService) Batch(ctx context.Context, ops []domain.BatchOp, atomic bool) ([]domain.BatchResult, bool, *domain.CustomError) {
+	if len(ops) == 0 || len(ops) > maxBatchOps {
+		return nil, false, domain.NewCustomError(0, domain.ErrBatchSize, domain.NewMessage("batch_size_range", "от 1 до %d операций", maxBatchOps))
+	}
+	results := make([]domain.BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = domain.BatchResult{Index: i, Op: op.Op}
+	}
+
+	pending := &pendingMetrics{next: s.metrics}
+	err := s.repo.WithTx(ctx, func(repo domain.TaskRepository) error {
+		tx := s.withRepo(repo)
+		tx.metrics = pending
+		for i, op := range ops {
+			if atomic {
+				task, cErr := tx.applyOp(ctx, op)
+				if cErr != nil {
+					results[i].Err = cErr
+					return errRollback
+				}
+				results[i].Task = task
+				continue
+			}
+
+			var task *domain.Task
+			var cErr *domain.CustomError
+			opMetrics := &pendingMetrics{next: pending}
+			err := repo.WithTx(ctx, func(savepoint domain.TaskRepository) error {
+				opTx := s.withRepo(savepoint)
+				opTx.metrics = opMetrics
+				task, cErr = opTx.applyOp(ctx, op)
+				if cErr != nil {
+					return errRollback
+				}
+				return nil
+			})
+			switch {
+			case cErr != nil:
+				results[i].Err = cErr
+			case err != nil:
+				results[i].Err = domain.NewCustomError(0, domain.ErrInternalServer, err)
+			default:
+				results[i].Task = task
+				opMetrics.commit()
+			}
+		}
+		return nil
+	})
+
+	if errors.Is(err, errRollback) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Task = nil
+				results[i].Err = domain.NewCustomError(0, domain.ErrBatchAborted, nil)
+			}
+		}
+		return results, false, nil
+	}
+	if err != nil {
+		return nil, false, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	pending.commit()
+	return results, true, nil
+}
+
+// applyOp выполняет одну операцию пакета теми же методами, что и одиночные запросы
+func (s *TaskService) applyOp(ctx context.Context, op domain.BatchOp) (*domain.Task, *domain.CustomError) {
+	if op.Op == domain.BatchCreate {
+		if op.Task == nil {
+			return nil, domain.NewCustomError(0, domain.ErrBadTitle, nil)
+		}
+		task := domain.NewTask(op.Task.TaskToOptions()...)
+		task.ID = ""
+		id, cErr := s.Create(ctx, task)
+		if cErr != nil {
+			return nil, cErr
+		}
+		task.ID = strconv.FormatInt(id, 10)
+		return task, nil
+	}
+
+	id, err := strconv.Atoi(op.ID)
+	if err != nil || id <= 0 {
+		return nil, domain.NewCustomError(0, domain.ErrID, err)
+	}
+	switch op.Op {
+	case domain.BatchUpdate:
+		if op.Task == nil {
+			return nil, domain.NewCustomError(0, domain.ErrBatchOp, domain.NewMessage("batch_update_task", "для update нужно поле task"))
+		}
+		return s.Patch(ctx, id, op.Task, op.Version)
+	case domain.BatchMove:
+		date, ok := parseQueryDate(op.Date)
+		if !ok {
+			return nil, domain.NewCustomError(0, domain.ErrDate, nil)
+		}
+		return s.Patch(ctx, id, &domain.TaskInput{Date: &date}, op.Version)
+	case domain.BatchDone:
+		return s.Done(ctx, &domain.Filter{ID: &id}, op.Version)
+	case domain.BatchDelete:
+		return nil, s.Delete(ctx, id, op.Version)
+	}
+	return nil, domain.NewCustomError(0, domain.ErrBatchOp, domain.NewMessage("batch_op_options",
+		"%q, доступны: create, update, done, delete, move", op.Op))
+}
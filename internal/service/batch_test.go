@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// taskMetrics считает события задач
+type taskMetrics struct {
+	created, completed, deleted, repeatErrors int
+}
+
+func (m *taskMetrics) TaskCreated()     { m.created++ }
+func (m *taskMetrics) TaskCompleted()   { m.completed++ }
+func (m *taskMetrics) TaskDeleted()     { m.deleted++ }
+func (m *taskMetrics) RepeatRuleError() { m.repeatErrors++ }
+
+// batchFixture - сервис с задачами в памяти: разовой "Отчет" и
+// повторяющейся "Зарядка"
+func batchFixture(t *testing.T) (*TaskService, *taskMetrics, string, string) {
+	t.Helper()
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	metrics := &taskMetrics{}
+	s := NewService(memory.NewTaskStore(), WithClock(FixedClock(now)), WithMetrics(metrics))
+	var ids []string
+	for _, task := range []*domain.Task{
+		{Title: "Отчет", Date: "20240201"},
+		{Title: "Зарядка", Date: "20240126", Repeat: "d 1"},
+	} {
+		id, cErr := s.Create(context.Background(), task)
+		if cErr != nil {
+			t.Fatal(cErr)
+		}
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	*metrics = taskMetrics{}
+	return s, metrics, ids[0], ids[1]
+}
+
+func allTasks(t *testing.T, s *TaskService) map[string]*domain.Task {
+	t.Helper()
+	tasks, cErr := s.FindAll(context.Background(), &domain.Filter{})
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	res := make(map[string]*domain.Task, len(tasks))
+	for _, task := range tasks {
+		res[task.Title] = task
+	}
+	return res
+}
+
+func batchErr(res domain.BatchResult) *domain.Error {
+	if res.Err == nil {
+		return nil
+	}
+	return res.Err.Err.(*domain.Error)
+}
+
+func TestBatchAtomicRollsBack(t *testing.T) {
+	s, metrics, report, exercise := batchFixture(t)
+	title := "Годовой отчет"
+
+	results, committed, cErr := s.Batch(context.Background(), []domain.BatchOp{
+		{Op: domain.BatchCreate, Task: &domain.TaskInput{Title: &title}},
+		{Op: domain.BatchDelete, ID: report},
+		{Op: domain.BatchDone, ID: exercise},
+		{Op: domain.BatchUpdate, ID: "999", Task: &domain.TaskInput{Title: &title}},
+	}, true)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if committed {
+		t.Error("пакет с ошибкой зафиксирован")
+	}
+	want := []*domain.Error{domain.ErrBatchAborted, domain.ErrBatchAborted, domain.ErrBatchAborted, domain.ErrNotFound}
+	for i, res := range results {
+		if res.Index != i || res.Task != nil || batchErr(res) != want[i] {
+			t.Errorf("операция %d: %+v, ожидалась ошибка %v", i, res, want[i])
+		}
+	}
+
+	tasks := allTasks(t, s)
+	if len(tasks) != 2 || tasks["Отчет"] == nil || tasks["Зарядка"] == nil || tasks[title] != nil {
+		t.Errorf("после отката: %v", tasks)
+	}
+	if tasks["Зарядка"] != nil && (tasks["Зарядка"].Date != "20240126" || tasks["Зарядка"].Version != 1) {
+		t.Errorf("откаченный done изменил задачу: %+v", tasks["Зарядка"])
+	}
+	if *metrics != (taskMetrics{}) {
+		t.Errorf("откаченные операции попали в метрики: %+v", *metrics)
+	}
+}
+
+func TestBatchBestEffortKeepsSuccesses(t *testing.T) {
+	s, metrics, report, exercise := batchFixture(t)
+	title, renamed := "Звонок", "Годовой отчет"
+
+	results, committed, cErr := s.Batch(context.Background(), []domain.BatchOp{
+		{Op: domain.BatchCreate, Task: &domain.TaskInput{Title: &title}},
+		{Op: domain.BatchUpdate, ID: report, Task: &domain.TaskInput{Title: &renamed}, Version: 1},
+		{Op: domain.BatchMove, ID: exercise, Date: "31.02.2024"},
+		{Op: domain.BatchDelete, ID: "999"},
+		{Op: domain.BatchDone, ID: exercise, Version: 5},
+		{Op: domain.BatchDone, ID: exercise},
+		{Op: "archive", ID: report},
+	}, false)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if !committed {
+		t.Error("best_effort пакет не зафиксирован")
+	}
+	want := []*domain.Error{nil, nil, domain.ErrDate, domain.ErrNotFound, domain.ErrVersion, nil, domain.ErrBatchOp}
+	for i, res := range results {
+		if res.Index != i || batchErr(res) != want[i] {
+			t.Errorf("операция %d: %v, ожидалась ошибка %v", i, res.Err, want[i])
+		}
+	}
+	if task := results[0].Task; task == nil || task.ID == "" || task.Title != title {
+		t.Errorf("create вернул %+v", task)
+	}
+	if task := results[5].Task; task == nil || task.Date != "20240127" {
+		t.Errorf("done повторяющейся задачи вернул %+v", task)
+	}
+
+	tasks := allTasks(t, s)
+	if tasks[title] == nil || tasks[renamed] == nil || tasks["Отчет"] != nil {
+		t.Errorf("успешные операции не сохранены: %v", tasks)
+	}
+	if tasks["Зарядка"] == nil || tasks["Зарядка"].Date != "20240127" {
+		t.Errorf("задача после done: %+v", tasks["Зарядка"])
+	}
+	if *metrics != (taskMetrics{created: 1, completed: 1}) {
+		t.Errorf("метрики: %+v", *metrics)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	s, _, _, _ := batchFixture(t)
+	for _, n := range []int{0, maxBatchOps + 1} {
+		ops := make([]domain.BatchOp, n)
+		for i := range ops {
+			ops[i] = domain.BatchOp{Op: domain.BatchDelete, ID: "1"}
+		}
+		if _, _, cErr := s.Batch(context.Background(), ops, true); cErr == nil || cErr.Err != domain.ErrBatchSize {
+			t.Errorf("пакет из %d операций: %v, ожидалось %v", n, cErr, domain.ErrBatchSize)
+		}
+	}
+}
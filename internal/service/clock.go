@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Clock - источник текущего времени для дат задач. Сроки токенов, входа
+// и Idempotency-Key всегда считаются по системным часам.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc позволяет использовать функцию как Clock
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock - системные часы
+var SystemClock Clock = ClockFunc(time.Now)
+
+// FixedClock - часы, остановленные на t
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time { return t })
+}
+
+// OffsetClock - часы clock, сдвинутые на d
+func OffsetClock(clock Clock, d time.Duration) Clock {
+	return ClockFunc(func() time.Time { return clock.Now().Add(d) })
+}
+
+var errClock = domain.NewMessage("debug_clock", "ожидается дата 20060102, время RFC 3339 или смещение вида +72h")
+
+// ParseClock разбирает отладочную настройку времени: пустая строка - часы base,
+// дата 20060102 или время RFC 3339 - остановленные часы, смещение со знаком
+// (+72h, -30m) - часы base, сдвинутые на это смещение
+func ParseClock(value string, base Clock) (Clock, error) {
+	value = strings.TrimSpace(value)
+	switch {
+	case value == "":
+		return base, nil
+	case strings.HasPrefix(value, "+"), strings.HasPrefix(value, "-"):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, errClock
+		}
+		return OffsetClock(base, d), nil
+	}
+	if t, err := time.ParseInLocation(dateForm, value, time.Local); err == nil {
+		return FixedClock(t), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return FixedClock(t), nil
+	}
+	return nil, errClock
+}
+
+// WithClock задает часы сервиса, по умолчанию SystemClock
+func WithClock(clock Clock) ServiceOption {
+	return func(s *TaskService) {
+		if clock != nil {
+			s.clock = clock
+		}
+	}
+}
+
+type clockKey struct{}
+
+// WithRequestClock подменяет часы сервиса для одного запроса
+func WithRequestClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// Now возвращает текущее время сервиса с учетом часов запроса
+func (s *TaskService) Now(ctx context.Context) time.Time {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock.Now()
+	}
+	return s.clock.Now()
+}
+
+// Clock возвращает часы сервиса без учета запроса
+func (s *TaskService) Clock() Clock {
+	return s.clock
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Курсор - base64 от JSON с датой и id последней задачи страницы
+// (и ее релевантностью, если это результаты поиска).
+// Клиент не должен разбирать его, формат может меняться.
+func encodeCursor(task *domain.Task, sort domain.Sort) (string, error) {
+	id, err := strconv.Atoi(task.ID)
+	if err != nil {
+		return "", err
+	}
+	cursor := domain.Cursor{Date: task.Date, ID: id, Sort: sort}
+	switch {
+	case sort == domain.SortTitle || sort == domain.SortTitleDesc:
+		cursor.Title = &task.Title
+	case task.Match != nil:
+		cursor.Rank = &task.Match.Rank
+	}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(raw string) (*domain.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var cursor domain.Cursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if _, err = time.Parse(dateForm, cursor.Date); err != nil || cursor.ID <= 0 {
+		return nil, domain.NewMessage("cursor_position", "курсор содержит некорректную позицию")
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	rank := float32(0.5)
+	tests := []struct {
+		task *domain.Task
+		sort domain.Sort
+	}{
+		{&domain.Task{ID: "7", Date: "20240201", Title: "Отчет"}, ""},
+		{&domain.Task{ID: "7", Date: "20240201", Title: "Отчет"}, domain.SortDateDesc},
+		{&domain.Task{ID: "7", Date: "20240201", Title: "Отчет"}, domain.SortTitle},
+		{&domain.Task{ID: "7", Date: "20240201", Title: "Отчет", Match: &domain.SearchMatch{Rank: rank}}, ""},
+	}
+	for _, tt := range tests {
+		raw, err := encodeCursor(tt.task, tt.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodeCursor(raw)
+		if err != nil {
+			t.Errorf("sort %q: %v", tt.sort, err)
+			continue
+		}
+		if got.Date != tt.task.Date || got.ID != 7 || got.Sort != tt.sort {
+			t.Errorf("sort %q: %+v", tt.sort, got)
+		}
+		// Заголовок нужен только при сортировке по заголовку, релевантность - при поиске
+		byTitle := tt.sort == domain.SortTitle || tt.sort == domain.SortTitleDesc
+		if (got.Title != nil) != byTitle || byTitle && *got.Title != tt.task.Title {
+			t.Errorf("sort %q: заголовок в курсоре %v", tt.sort, got.Title)
+		}
+		if (got.Rank != nil) != (tt.task.Match != nil) || got.Rank != nil && *got.Rank != rank {
+			t.Errorf("sort %q: релевантность в курсоре %v", tt.sort, got.Rank)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsTampering(t *testing.T) {
+	valid, err := encodeCursor(&domain.Task{ID: "7", Date: "20240201"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, raw := range []string{
+		valid + "!",
+		valid[:len(valid)-3],
+		"не base64",
+		encode(`{"d":"20240201"`),
+		encode(`{"d":"20240201","i":0}`),
+		encode(`{"d":"20240201","i":-3}`),
+		encode(`{"d":"2024-02-01","i":7}`),
+		encode(`{"d":"20240201","i":"7"}`),
+		encode(`{"i":7}`),
+	} {
+		if cursor, err := decodeCursor(raw); err == nil {
+			t.Errorf("%q: принят курсор %+v", raw, cursor)
+		}
+	}
+}
+
+func TestFindPageCursor(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	s := NewService(memory.NewTaskStore(), WithClock(FixedClock(now)))
+	for i := 1; i <= 5; i++ {
+		task := &domain.Task{Title: fmt.Sprintf("Задача %d", i), Date: fmt.Sprintf("202402%02d", i)}
+		if _, cErr := s.Create(ctx, task); cErr != nil {
+			t.Fatal(cErr)
+		}
+	}
+
+	// Страницы по 2: курсор есть, пока после страницы остаются задачи
+	var titles []string
+	var cursors []string
+	cursor := ""
+	for range 3 {
+		page, cErr := s.FindPage(ctx, &domain.Filter{Limit: 2, Cursor: cursor})
+		if cErr != nil {
+			t.Fatal(cErr)
+		}
+		for _, task := range page.Tasks {
+			titles = append(titles, task.Title)
+		}
+		cursors = append(cursors, page.NextCursor)
+		cursor = page.NextCursor
+	}
+	if got := strings.Join(titles, ", "); got != "Задача 1, Задача 2, Задача 3, Задача 4, Задача 5" {
+		t.Errorf("задачи по страницам: %s", got)
+	}
+	if cursors[0] == "" || cursors[1] == "" || cursors[2] != "" {
+		t.Errorf("курсоры страниц: %q", cursors)
+	}
+
+	// Страница ровно до последней задачи: проба limit+1 ничего не находит
+	page, cErr := s.FindPage(ctx, &domain.Filter{Limit: 5})
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if len(page.Tasks) != 5 || page.NextCursor != "" {
+		t.Errorf("одна полная страница: %d задач, курсор %q", len(page.Tasks), page.NextCursor)
+	}
+
+	// Курсор сортировки по дате нельзя продолжить сортировкой по заголовку
+	_, cErr = s.FindPage(ctx, &domain.Filter{Limit: 2, Cursor: cursors[0], Sort: domain.SortTitle})
+	if cErr == nil || cErr.Err != domain.ErrCursor || cErr.ErrStorage == nil ||
+		cErr.ErrStorage.Error() != "курсор получен для другой сортировки" {
+		t.Errorf("курсор другой сортировки = %v", cErr)
+	}
+
+	if _, cErr = s.FindPage(ctx, &domain.Filter{Limit: 2, Cursor: "подделка"}); cErr == nil || cErr.Err != domain.ErrCursor {
+		t.Errorf("поддельный курсор = %v, ожидалось %v", cErr, domain.ErrCursor)
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+const (
+	defaultIdempotencyTTL time.Duration = 24 * time.Hour
+	// idempotencyLease - срок, на который ключ занимается до ответа. Если процесс
+	// упал посреди запроса, ключ освободится через минуту, а не через сутки.
+	idempotencyLease  time.Duration = time.Minute
+	maxIdempotencyKey int           = 255
+)
+
+// Idempotency запоминает ответы на запросы с заголовком Idempotency-Key,
+// чтобы повтор того же запроса вернул прежний ответ, а не выполнил его снова
+type Idempotency struct {
+	store domain.IdempotencyStore
+	ttl   time.Duration
+}
+
+func NewIdempotency(store domain.IdempotencyStore, ttl time.Duration) *Idempotency {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &Idempotency{store: store, ttl: ttl}
+}
+
+// ValidKey проверяет ключ: от 1 до 255 видимых ASCII-символов
+func ValidKey(key string) bool {
+	if key == "" || len(key) > maxIdempotencyKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x21 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Begin занимает ключ под запрос с хэшем hash. Если ключ свободен, возвращает
+// nil и запрос нужно выполнить; если по ключу уже есть ответ - возвращает его.
+func (s *Idempotency) Begin(ctx context.Context, key, hash string) (*domain.IdempotencyRecord, *domain.CustomError) {
+	record := &domain.IdempotencyRecord{
+		Key:         key,
+		RequestHash: hash,
+		ExpiresAt:   time.Now().UTC().Add(idempotencyLease),
+	}
+	existing, err := s.store.ReserveIdempotencyKey(ctx, record)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	if existing == nil {
+		return nil, nil
+	}
+	if existing.RequestHash != hash {
+		return nil, domain.NewCustomError(0, domain.ErrIdempotencyUsed, nil)
+	}
+	if !existing.Completed {
+		return nil, domain.NewCustomError(0, domain.ErrIdempotencyBusy, nil)
+	}
+	return existing, nil
+}
+
+// Finish сохраняет ответ на запрос, начатый Begin, на полный срок хранения
+func (s *Idempotency) Finish(ctx context.Context, record *domain.IdempotencyRecord) *domain.CustomError {
+	record.Completed = true
+	record.ExpiresAt = time.Now().UTC().Add(s.ttl)
+	if err := s.store.CompleteIdempotencyKey(ctx, record); err != nil {
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return nil
+}
+
+// Abort освобождает ключ, если запрос не удалось выполнить и его можно повторить
+func (s *Idempotency) Abort(ctx context.Context, key string) *domain.CustomError {
+	if err := s.store.ReleaseIdempotencyKey(ctx, key); err != nil {
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return nil
+}
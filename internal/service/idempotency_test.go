@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// leaseStore запоминает сроки, с которыми ключ занимается и сохраняется
+type leaseStore struct {
+	*memory.IdempotencyStore
+	reserved, completed time.Time
+}
+
+func (s *leaseStore) ReserveIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	s.reserved = record.ExpiresAt
+	return s.IdempotencyStore.ReserveIdempotencyKey(ctx, record)
+}
+
+func (s *leaseStore) CompleteIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) error {
+	s.completed = record.ExpiresAt
+	return s.IdempotencyStore.CompleteIdempotencyKey(ctx, record)
+}
+
+func TestIdempotencyLease(t *testing.T) {
+	store := &leaseStore{IdempotencyStore: memory.NewIdempotencyStore()}
+	s := NewIdempotency(store, 24*time.Hour)
+	ctx := context.Background()
+	start := time.Now()
+
+	if _, cErr := s.Begin(ctx, "k1", "hash"); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if lease := store.reserved.Sub(start); lease < 0 || lease > idempotencyLease+time.Second {
+		t.Errorf("ключ занят на %v, ожидалась аренда %v", lease, idempotencyLease)
+	}
+	if _, cErr := s.Begin(ctx, "k1", "hash"); cErr == nil || cErr.Err != domain.ErrIdempotencyBusy {
+		t.Errorf("повтор во время выполнения = %v, ожидалось %v", cErr, domain.ErrIdempotencyBusy)
+	}
+
+	if cErr := s.Finish(ctx, &domain.IdempotencyRecord{Key: "k1", RequestHash: "hash", Status: 201}); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if ttl := store.completed.Sub(start); ttl < 24*time.Hour-time.Second {
+		t.Errorf("ответ сохранен на %v, ожидалось 24h", ttl)
+	}
+	stored, cErr := s.Begin(ctx, "k1", "hash")
+	if cErr != nil || stored == nil || stored.Status != 201 {
+		t.Errorf("Begin после Finish = %+v, %v", stored, cErr)
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+)
+
+const (
+	loginFreeAttempts  int           = 5
+	loginBaseLockout   time.Duration = 30 * time.Second
+	loginMaxLockout    time.Duration = time.Hour
+	loginFailureWindow time.Duration = time.Hour
+)
+
+// LoginGuard ограничивает перебор паролей. Неудачные попытки считаются
+// отдельно для IP и для учетной записи: после loginFreeAttempts ошибок ключ
+// блокируется, и каждая следующая ошибка удваивает время блокировки.
+type LoginGuard struct {
+	store domain.LoginAttemptStore
+}
+
+func NewLoginGuard(store domain.LoginAttemptStore) *LoginGuard {
+	return &LoginGuard{store: store}
+}
+
+func loginKeys(ip, account string) []string {
+	return []string{"ip:" + ip, "account:" + account}
+}
+
+// Check возвращает время до снятия блокировки, если вход сейчас запрещен
+func (g *LoginGuard) Check(ctx context.Context, ip, account string) (time.Duration, *domain.CustomError) {
+	now := time.Now().UTC()
+	var retryAfter time.Duration
+	for _, key := range loginKeys(ip, account) {
+		state, err := g.store.GetLoginState(ctx, key)
+		if err != nil {
+			return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+		}
+		if state != nil && state.LockedUntil.After(now) {
+			retryAfter = max(retryAfter, state.LockedUntil.Sub(now))
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, domain.NewCustomError(0, domain.ErrTooManyLogins, nil)
+	}
+	return 0, nil
+}
+
+// Fail учитывает неудачную попытку и возвращает наступившую блокировку, если она есть
+func (g *LoginGuard) Fail(ctx context.Context, ip, account string) (time.Duration, *domain.CustomError) {
+	now := time.Now().UTC()
+	err := g.store.RecordLoginAttempt(ctx, &domain.LoginAttempt{Account: account, IP: ip, At: now})
+	if err != nil {
+		return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+
+	var retryAfter time.Duration
+	for _, key := range loginKeys(ip, account) {
+		state, err := g.store.IncrementLoginFailures(ctx, key, now, loginFailureWindow)
+		if err != nil {
+			return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+		}
+		if lockout := lockoutFor(state.Failures); lockout > 0 {
+			if err = g.store.LockLogin(ctx, key, now.Add(lockout)); err != nil {
+				return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+			}
+			retryAfter = max(retryAfter, lockout)
+			logging.FromContext(ctx).Warn("Login locked", "key", key, "failures", state.Failures, "lockout", lockout)
+		}
+	}
+	return retryAfter, nil
+}
+
+// Succeed сбрасывает счетчики после успешного входа
+func (g *LoginGuard) Succeed(ctx context.Context, ip, account string) *domain.CustomError {
+	err := g.store.RecordLoginAttempt(ctx, &domain.LoginAttempt{Account: account, IP: ip, Success: true, At: time.Now().UTC()})
+	if err != nil {
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	for _, key := range loginKeys(ip, account) {
+		if err = g.store.ResetLoginState(ctx, key); err != nil {
+			return domain.NewCustomError(0, domain.ErrInternalServer, err)
+		}
+	}
+	return nil
+}
+
+func lockoutFor(failures int) time.Duration {
+	if failures < loginFreeAttempts {
+		return 0
+	}
+	lockout := loginBaseLockout
+	for i := loginFreeAttempts; i < failures; i++ {
+		lockout *= 2
+		if lockout >= loginMaxLockout {
+			return loginMaxLockout
+		}
+	}
+	return lockout
+}
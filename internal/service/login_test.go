@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// quietContext убирает из вывода тестов предупреждения о блокировках
+func quietContext() context.Context {
+	return logging.WithLogger(context.Background(), slog.New(slog.DiscardHandler))
+}
+
+func TestLoginGuardConcurrentFailures(t *testing.T) {
+	store := memory.NewLoginStore()
+	guard := NewLoginGuard(store)
+	ctx := quietContext()
+
+	const attempts = 50
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, cErr := guard.Fail(ctx, "10.0.0.1", "admin"); cErr != nil {
+				t.Error(cErr)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range loginKeys("10.0.0.1", "admin") {
+		state, err := store.GetLoginState(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state == nil || state.Failures != attempts {
+			t.Fatalf("%s: %+v, ожидалось %d ошибок", key, state, attempts)
+		}
+	}
+	retryAfter, cErr := guard.Check(ctx, "10.0.0.2", "admin")
+	if cErr == nil || cErr.Err != domain.ErrTooManyLogins || retryAfter < loginMaxLockout-time.Minute {
+		t.Errorf("Check = %v, %v, ожидалась блокировка учетной записи на %v", retryAfter, cErr, loginMaxLockout)
+	}
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	guard := NewLoginGuard(memory.NewLoginStore())
+	ctx := quietContext()
+
+	for i := 1; i < loginFreeAttempts; i++ {
+		if retryAfter, _ := guard.Fail(ctx, "10.0.0.1", "admin"); retryAfter != 0 {
+			t.Fatalf("попытка %d: блокировка %v", i, retryAfter)
+		}
+	}
+	for _, want := range []int{1, 2, 4} {
+		retryAfter, _ := guard.Fail(ctx, "10.0.0.1", "admin")
+		if retryAfter != loginBaseLockout*time.Duration(want) {
+			t.Fatalf("блокировка %v, ожидалось %v", retryAfter, loginBaseLockout*time.Duration(want))
+		}
+	}
+	if cErr := guard.Succeed(ctx, "10.0.0.1", "admin"); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if _, cErr := guard.Check(ctx, "10.0.0.1", "admin"); cErr != nil {
+		t.Errorf("после успешного входа: %v", cErr)
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import "github.com/agidelle/TODO_web_v2/internal/domain"
+
+// TaskMetrics учитывает события задач для мониторинга
+type TaskMetrics interface {
+	TaskCreated()
+	TaskCompleted()
+	TaskDeleted()
+	RepeatRuleError()
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) TaskCreated()     {}
+func (nopMetrics) TaskCompleted()   {}
+func (nopMetrics) TaskDeleted()     {}
+func (nopMetrics) RepeatRuleError() {}
+
+// WithMetrics включает учет событий задач
+func WithMetrics(metrics TaskMetrics) ServiceOption {
+	return func(s *TaskService) {
+		if metrics != nil {
+			s.metrics = metrics
+		}
+	}
+}
+
+// pendingMetrics копит события операций пакета, пока транзакция не
+// зафиксирована: откаченные операции не должны попадать в счетчики.
+// Ошибки правил повторения учитываются сразу - они не зависят от фиксации.
+type pendingMetrics struct {
+	next                        TaskMetrics
+	created, completed, deleted int
+}
+
+func (p *pendingMetrics) TaskCreated()     { p.created++ }
+func (p *pendingMetrics) TaskCompleted()   { p.completed++ }
+func (p *pendingMetrics) TaskDeleted()     { p.deleted++ }
+func (p *pendingMetrics) RepeatRuleError() { p.next.RepeatRuleError() }
+
+// commit передает накопленные события дальше
+func (p *pendingMetrics) commit() {
+	for range p.created {
+		p.next.TaskCreated()
+	}
+	for range p.completed {
+		p.next.TaskCompleted()
+	}
+	for range p.deleted {
+		p.next.TaskDeleted()
+	}
+}
+
+// repeatFailed сообщает, относится ли ошибка проверки к правилу повторения
+func repeatFailed(cErr *domain.CustomError) bool {
+	for _, field := range cErr.Fields {
+		if field.Pointer == "/repeat" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// Эталонные случаи из тестов курса; все считаются от одной даты
+const goldenNow = "20240126"
+
+func TestNextDateGolden(t *testing.T) {
+	tests := []struct {
+		date   string
+		repeat string
+		want   string // пусто - ожидается ошибка
+	}{
+		{"20240126", "", "delete"},
+		{"20240126", "k 34", ""},
+		{"20240126", "ooops", ""},
+		{"15000156", "y", ""},
+		{"ooops", "y", ""},
+		{"16890220", "y", "20240220"},
+		{"20250701", "y", "20260701"},
+		{"20240101", "y", "20250101"},
+		{"20231231", "y", "20241231"},
+		{"20240229", "y", "20250301"},
+		{"20240301", "y", "20250301"},
+		{"20240113", "d", ""},
+		{"20240113", "d 7", "20240127"},
+		{"20240120", "d 20", "20240209"},
+		{"20240202", "d 30", "20240303"},
+		{"20240320", "d 401", ""},
+		{"20231225", "d 12", "20240130"},
+		{"20240228", "d 1", "20240229"},
+		{"20231106", "m 13", "20240213"},
+		{"20240120", "m 40,11,19", ""},
+		{"20240116", "m 16,5", "20240205"},
+		{"20240126", "m 25,26,7", "20240207"},
+		{"20240409", "m 31", "20240531"},
+		{"20240329", "m 10,17 12,8,1", "20240810"},
+		{"20230311", "m 07,19 05,6", "20240507"},
+		{"20230311", "m 1 1,2", "20240201"},
+		{"20240127", "m -1", "20240131"},
+		{"20240222", "m -2", "20240228"},
+		{"20240222", "m -2,-3", ""},
+		{"20240326", "m -1,-2", "20240330"},
+		{"20240201", "m -1,18", "20240218"},
+		{"20240125", "w 1,2,3", "20240129"},
+		{"20240126", "w 7", "20240128"},
+		{"20230126", "w 4,5", "20240201"},
+		{"20230226", "w 8,4,5", ""},
+		// Граничные случаи сверх курса
+		{"20240130", "m 31", "20240131"},
+		{"20240201", "m 31", "20240331"},
+		{"20240201", "m 30,31 2", ""},
+		{"20240126", "m 29 2", "20240229"},
+		{"20240301", "m 29 2", "20280229"},
+		{"20241215", "m -1", "20241231"},
+		{"20241231", "d 1", "20250101"},
+		{"20240126", "w 5", "20240202"},
+	}
+
+	s := &TaskService{}
+	now, err := time.Parse(dateForm, goldenNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.date+" "+tt.repeat, func(t *testing.T) {
+			got, err := s.NextDate(now, tt.date, tt.repeat)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("NextDate(%q, %q) = %q, ожидалась ошибка", tt.date, tt.repeat, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextDate(%q, %q): %v", tt.date, tt.repeat, err)
+			}
+			if got != tt.want {
+				t.Errorf("NextDate(%q, %q) = %q, ожидалось %q", tt.date, tt.repeat, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksMinRefresh - не чаще этого перезапрашиваем JWKS при незнакомом kid
+const jwksMinRefresh time.Duration = time.Minute
+
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Allowed - адреса почты или домены вида "@example.com", которым разрешено
+	// впервые войти через провайдера. Пустой список разрешает только уже связанные учетные записи.
+	Allowed []string
+	// Account - локальная учетная запись, с которой связываются новые входы
+	Account string
+}
+
+// OIDCRequest - параметры, которые нужно сохранить между редиректом на провайдера и callback
+type OIDCRequest struct {
+	URL      string
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCService реализует authorization code flow с PKCE
+type OIDCService struct {
+	cfg    OIDCConfig
+	repo   domain.IdentityRepository
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+type OIDCOption func(*OIDCService)
+
+func NewOIDCService(cfg OIDCConfig, repo domain.IdentityRepository, opts ...OIDCOption) *OIDCService {
+	s := &OIDCService{
+		cfg:    cfg,
+		repo:   repo,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithOIDCHTTPClient задает HTTP-клиент для обращений к провайдеру
+func WithOIDCHTTPClient(client *http.Client) OIDCOption {
+	return func(s *OIDCService) {
+		s.client = client
+	}
+}
+
+// WithOIDCClock подменяет источник времени для проверки срока действия ID token
+func WithOIDCClock(now func() time.Time) OIDCOption {
+	return func(s *OIDCService) {
+		s.now = now
+	}
+}
+
+// AuthRequest готовит адрес редиректа на провайдера
+func (s *OIDCService) AuthRequest(ctx context.Context) (*OIDCRequest, *domain.CustomError) {
+	disc, err := s.getDiscovery(ctx)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrOIDC, err)
+	}
+	req := &OIDCRequest{}
+	for _, v := range []*string{&req.State, &req.Nonce, &req.Verifier} {
+		if *v, err = randomString(32); err != nil {
+			return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+		}
+	}
+	challenge := sha256.Sum256([]byte(req.Verifier))
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", s.cfg.ClientID)
+	q.Set("redirect_uri", s.cfg.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", req.State)
+	q.Set("nonce", req.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(disc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	req.URL = disc.AuthorizationEndpoint + sep + q.Encode()
+	return req, nil
+}
+
+// Exchange обменивает код на ID token, проверяет его и возвращает локальную учетную запись
+func (s *OIDCService) Exchange(ctx context.Context, code, verifier, nonce string) (string, *domain.CustomError) {
+	disc, err := s.getDiscovery(ctx)
+	if err != nil {
+		return "", domain.NewCustomError(0, domain.ErrOIDC, err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", s.cfg.RedirectURL)
+	form.Set("client_id", s.cfg.ClientID)
+	form.Set("code_verifier", verifier)
+	if s.cfg.ClientSecret != "" {
+		form.Set("client_secret", s.cfg.ClientSecret)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, disc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", domain.NewCustomError(0, domain.ErrOIDC, err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = s.doJSON(httpReq, &tokenResp); err != nil {
+		return "", domain.NewCustomError(0, domain.ErrOIDC, err)
+	}
+	if tokenResp.IDToken == "" {
+		return "", domain.NewCustomError(0, domain.ErrOIDC, domain.NewMessage("oidc_no_id_token", "провайдер не вернул id_token"))
+	}
+
+	claims, err := s.verifyIDToken(ctx, tokenResp.IDToken, nonce)
+	if err != nil {
+		return "", domain.NewCustomError(0, domain.ErrOIDC, err)
+	}
+	return s.mapIdentity(ctx, claims)
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	AZP           string `json:"azp"`
+}
+
+func (s *OIDCService) verifyIDToken(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return s.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "EdDSA"}),
+		jwt.WithIssuer(s.cfg.Issuer),
+		jwt.WithAudience(s.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("недействительный id_token: %w", err)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("nonce в id_token не совпадает")
+	}
+	if len(claims.Audience) > 1 && claims.AZP != s.cfg.ClientID {
+		return nil, errors.New("azp в id_token не совпадает с client_id")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("в id_token нет sub")
+	}
+	return claims, nil
+}
+
+// mapIdentity находит связанную локальную учетную запись или создает связь,
+// если почта пользователя разрешена конфигурацией
+func (s *OIDCService) mapIdentity(ctx context.Context, claims *idTokenClaims) (string, *domain.CustomError) {
+	identity, err := s.repo.FindIdentity(ctx, s.cfg.Issuer, claims.Subject)
+	if err != nil {
+		return "", domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	if identity != nil {
+		return identity.Account, nil
+	}
+
+	// Почту, которую провайдер явно не подтвердил, для новой связи не принимаем
+	verified := claims.EmailVerified != nil && *claims.EmailVerified
+	if claims.Email == "" || !verified || !s.allowed(claims.Email) {
+		return "", domain.NewCustomError(0, domain.ErrOIDCIdentity, nil)
+	}
+	identity = &domain.Identity{
+		Issuer:    s.cfg.Issuer,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		Account:   s.cfg.Account,
+		CreatedAt: s.now().UTC(),
+	}
+	if err = s.repo.SaveIdentity(ctx, identity); err != nil {
+		return "", domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return identity.Account, nil
+}
+
+func (s *OIDCService) allowed(email string) bool {
+	email = strings.ToLower(email)
+	for _, rule := range s.cfg.Allowed {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+		if strings.HasPrefix(rule, "@") && strings.HasSuffix(email, rule) {
+			return true
+		}
+		if rule == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OIDCService) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.discovery != nil {
+		return s.discovery, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(s.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var disc oidcDiscovery
+	if err = s.doJSON(req, &disc); err != nil {
+		return nil, err
+	}
+	if disc.Issuer != s.cfg.Issuer {
+		return nil, fmt.Errorf("issuer провайдера %q не совпадает с настроенным %q", disc.Issuer, s.cfg.Issuer)
+	}
+	if disc.AuthorizationEndpoint == "" || disc.TokenEndpoint == "" || disc.JWKSURI == "" {
+		return nil, errors.New("неполный документ discovery")
+	}
+	s.discovery = &disc
+	return s.discovery, nil
+}
+
+// publicKey ищет ключ по kid; при незнакомом kid перечитывает JWKS,
+// так провайдер может ротировать ключи без перезапуска сервера
+func (s *OIDCService) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	disc, err := s.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.lookupKey(kid); ok {
+		return key, nil
+	}
+	if s.now().Sub(s.keysFetched) < jwksMinRefresh && s.keys != nil {
+		return nil, fmt.Errorf("неизвестный kid %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, disc.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS: статус %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := jwks.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+	s.keysFetched = s.now()
+
+	if key, ok := s.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("неизвестный kid %q", kid)
+}
+
+// lookupKey допускает отсутствие kid, если у провайдера единственный ключ
+func (s *OIDCService) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (s *OIDCService) doJSON(req *http.Request, dst any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: статус %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst)
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
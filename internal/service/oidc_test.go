@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/jwks"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "todo-client"
+	testVerifier = "verifier"
+	testNonce    = "nonce"
+)
+
+// identityRepo - связи учетных записей в памяти для тестов
+type identityRepo map[string]domain.Identity
+
+func (r identityRepo) FindIdentity(_ context.Context, issuer, subject string) (*domain.Identity, error) {
+	identity, ok := r[issuer+" "+subject]
+	if !ok {
+		return nil, nil
+	}
+	return &identity, nil
+}
+
+func (r identityRepo) SaveIdentity(_ context.Context, identity *domain.Identity) error {
+	r[identity.Issuer+" "+identity.Subject] = *identity
+	return nil
+}
+
+// mockIssuer - OIDC-провайдер на httptest: discovery, JWKS и token endpoint,
+// который возвращает ID token с заданными тестом claims
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+	// signer, если задан, подписывает ID token вместо ключа из JWKS
+	signer *rsa.PrivateKey
+	// form - последний запрос к token endpoint
+	form url.Values
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, err := jwks.KeyFromPublic("k1", "RS256", &m.key.PublicKey)
+		if err != nil {
+			t.Error(err)
+		}
+		writeJSON(w, jwks.Set{Keys: []jwks.Key{jwk}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		m.form = r.PostForm
+		signer := m.key
+		if m.signer != nil {
+			signer = m.signer
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "k1"
+		raw, err := token.SignedString(signer)
+		if err != nil {
+			t.Error(err)
+		}
+		writeJSON(w, map[string]string{"id_token": raw, "token_type": "Bearer"})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// validClaims - claims корректного ID token для новой учетной записи
+func (m *mockIssuer) validClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            testClientID,
+		"sub":            "user-1",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          testNonce,
+		"email":          "Alice@Example.com",
+		"email_verified": true,
+	}
+}
+
+func (m *mockIssuer) service(repo identityRepo, now time.Time) *OIDCService {
+	return NewOIDCService(OIDCConfig{
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://todo.example.com/api/oidc/callback",
+		Allowed:     []string{"@example.com"},
+		Account:     "admin",
+	}, repo, WithOIDCHTTPClient(m.server.Client()), WithOIDCClock(func() time.Time { return now }))
+}
+
+func TestOIDCAuthRequest(t *testing.T) {
+	m := newMockIssuer(t)
+	s := m.service(identityRepo{}, time.Now())
+
+	req, cErr := s.AuthRequest(context.Background())
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/authorize" || q.Get("client_id") != testClientID || q.Get("response_type") != "code" {
+		t.Errorf("URL = %s", req.URL)
+	}
+	if q.Get("state") != req.State || q.Get("nonce") != req.Nonce || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("URL = %s", req.URL)
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge") == req.Verifier {
+		t.Error("в адрес попал verifier вместо challenge")
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(m *mockIssuer, claims jwt.MapClaims)
+		nonce  string
+		want   *domain.Error // nil - вход разрешен
+	}{
+		{"valid", nil, testNonce, nil},
+		{"email_verified missing", func(_ *mockIssuer, c jwt.MapClaims) { delete(c, "email_verified") }, testNonce, domain.ErrOIDCIdentity},
+		{"email_verified false", func(_ *mockIssuer, c jwt.MapClaims) { c["email_verified"] = false }, testNonce, domain.ErrOIDCIdentity},
+		{"email not allowed", func(_ *mockIssuer, c jwt.MapClaims) { c["email"] = "mallory@evil.com" }, testNonce, domain.ErrOIDCIdentity},
+		{"nonce mismatch", nil, "other", domain.ErrOIDC},
+		{"wrong audience", func(_ *mockIssuer, c jwt.MapClaims) { c["aud"] = "someone-else" }, testNonce, domain.ErrOIDC},
+		{"wrong issuer", func(_ *mockIssuer, c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, testNonce, domain.ErrOIDC},
+		{"expired", func(_ *mockIssuer, c jwt.MapClaims) { c["exp"] = now.Add(-time.Minute).Unix() }, testNonce, domain.ErrOIDC},
+		{"no sub", func(_ *mockIssuer, c jwt.MapClaims) { delete(c, "sub") }, testNonce, domain.ErrOIDC},
+		{"foreign key", func(m *mockIssuer, _ jwt.MapClaims) { m.signer = other }, testNonce, domain.ErrOIDC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			m.claims = m.validClaims(now)
+			if tt.change != nil {
+				tt.change(m, m.claims)
+			}
+			repo := identityRepo{}
+			s := m.service(repo, now)
+
+			account, cErr := s.Exchange(context.Background(), "code", testVerifier, tt.nonce)
+			if tt.want != nil {
+				if cErr == nil || cErr.Err != tt.want {
+					t.Fatalf("Exchange = %q, %v, ожидалось %v", account, cErr, tt.want)
+				}
+				if len(repo) != 0 {
+					t.Error("связь сохранена при отказе во входе")
+				}
+				return
+			}
+			if cErr != nil {
+				t.Fatal(cErr)
+			}
+			if account != "admin" {
+				t.Errorf("account = %q", account)
+			}
+			if m.form.Get("code_verifier") != testVerifier || m.form.Get("code") != "code" {
+				t.Errorf("запрос к token endpoint: %v", m.form)
+			}
+			if _, ok := repo[m.server.URL+" user-1"]; !ok {
+				t.Error("связь с учетной записью не сохранена")
+			}
+		})
+	}
+}
+
+func TestOIDCLinkedIdentitySkipsAllowList(t *testing.T) {
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	m := newMockIssuer(t)
+	m.claims = m.validClaims(now)
+	delete(m.claims, "email")
+	delete(m.claims, "email_verified")
+	repo := identityRepo{m.server.URL + " user-1": {Issuer: m.server.URL, Subject: "user-1", Account: "linked"}}
+
+	account, cErr := m.service(repo, now).Exchange(context.Background(), "code", testVerifier, testNonce)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if account != "linked" {
+		t.Errorf("account = %q, ожидалась связанная учетная запись", account)
+	}
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+func TestPatch(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	s := NewService(memory.NewTaskStore(), WithClock(FixedClock(now)))
+
+	id64, cErr := s.Create(ctx, &domain.Task{
+		Title:    "Отчет",
+		Date:     "20240201",
+		Comment:  "квартальный",
+		Repeat:   "d 7",
+		Tags:     []string{"work"},
+		Priority: domain.PriorityHigh,
+	})
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	id := int(id64)
+
+	// Меняется только заголовок, остальные поля не переданы и остаются прежними
+	input, err := domain.ParseMergePatch([]byte(`{"title":"Годовой отчет"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, cErr := s.Patch(ctx, id, input, 1)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if task.Title != "Годовой отчет" || task.Date != "20240201" || task.Comment != "квартальный" ||
+		task.Repeat != "d 7" || !slices.Equal(task.Tags, []string{"work"}) || task.Priority != domain.PriorityHigh {
+		t.Errorf("после замены заголовка: %+v", task)
+	}
+	if task.Version != 2 {
+		t.Errorf("версия %d, ожидалась 2", task.Version)
+	}
+
+	// null очищает поля
+	input, err = domain.ParseMergePatch([]byte(`{"comment":null,"repeat":null,"tags":null,"priority":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, cErr = s.Patch(ctx, id, input, task.Version)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if task.Comment != "" || task.Repeat != "" || len(task.Tags) != 0 || task.Priority != domain.PriorityNone {
+		t.Errorf("после очистки: %+v", task)
+	}
+	if task.Title != "Годовой отчет" || task.Date != "20240201" {
+		t.Errorf("очистка задела другие поля: %+v", task)
+	}
+
+	// Устаревший If-Match: задачу уже изменили, версия 1 не совпадает
+	input, err = domain.ParseMergePatch([]byte(`{"title":"Чужая правка"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, cErr = s.Patch(ctx, id, input, 1); cErr == nil || cErr.Err != domain.ErrVersion {
+		t.Errorf("Patch со старой версией = %v, ожидалось %v", cErr, domain.ErrVersion)
+	}
+	tasks, cErr := s.FindAll(ctx, &domain.Filter{ID: &id})
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if tasks[0].Title != "Годовой отчет" || tasks[0].Version != task.Version {
+		t.Errorf("конфликт версий изменил задачу: %+v", tasks[0])
+	}
+
+	// Очистка обязательного поля не проходит проверку
+	input, err = domain.ParseMergePatch([]byte(`{"title":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, cErr = s.Patch(ctx, id, input, 0); cErr == nil || cErr.Err != domain.ErrBadTitle {
+		t.Errorf("Patch с title=null = %v, ожидалось %v", cErr, domain.ErrBadTitle)
+	}
+
+	if _, cErr = s.Patch(ctx, id+100, &domain.TaskInput{}, 0); cErr == nil || cErr.Err != domain.ErrNotFound {
+		t.Errorf("Patch неизвестной задачи = %v, ожидалось %v", cErr, domain.ErrNotFound)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Максимальная длина периода "ближайшие N дней"
+const maxPeriodDays = 366
+
+// 7d, 7 days, next 7 days, 7 дней, ближайшие 7 дней
+var periodDays = regexp.MustCompile(`^(?:next\s+|ближайшие\s+)?(\d+)\s*(?:d|days?|дн(?:я|ей|ь)?)$`)
+
+// parsePeriod переводит именованный период в диапазон дат относительно now
+func parsePeriod(period string, now time.Time) (from, to string, ok bool) {
+	period = strings.ToLower(strings.Join(strings.Fields(period), " "))
+	today := now.Format(dateForm)
+	switch period {
+	case "today", "сегодня":
+		return today, today, true
+	case "week", "this week", "неделя", "эта неделя":
+		// Неделя начинается с понедельника
+		offset := (int(now.Weekday()) + 6) % 7
+		monday := now.AddDate(0, 0, -offset)
+		return monday.Format(dateForm), monday.AddDate(0, 0, 6).Format(dateForm), true
+	case "overdue", "просрочено", "просроченные":
+		return "", now.AddDate(0, 0, -1).Format(dateForm), true
+	}
+	if m := periodDays.FindStringSubmatch(period); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil || days < 1 || days > maxPeriodDays {
+			return "", "", false
+		}
+		return today, now.AddDate(0, 0, days-1).Format(dateForm), true
+	}
+	return "", "", false
+}
+
+// parseDateRange разбирает диапазон из строки поиска: 01.02.2026-10.02.2026
+// или 2026-02-01..2026-02-10. Дефис встречается и внутри дат, поэтому
+// пробуем каждый разделитель, пока обе части не окажутся датами.
+func parseDateRange(value string) (from, to string, ok bool) {
+	value = strings.TrimSpace(value)
+	for _, sep := range []string{"..", "-"} {
+		for i := strings.Index(value, sep); i >= 0; {
+			from, okFrom := parseQueryDate(strings.TrimSpace(value[:i]))
+			to, okTo := parseQueryDate(strings.TrimSpace(value[i+len(sep):]))
+			if okFrom && okTo {
+				return from, to, true
+			}
+			next := strings.Index(value[i+len(sep):], sep)
+			if next < 0 {
+				break
+			}
+			i += len(sep) + next
+		}
+	}
+	return "", "", false
+}
+
+// resolveDates проверяет границы фильтра, переводит Period в From/To
+// и сужает диапазон до пересечения всех условий
+func resolveDates(filter *domain.Filter, now time.Time) *domain.CustomError {
+	for _, bound := range []*string{&filter.From, &filter.To} {
+		if *bound == "" {
+			continue
+		}
+		date, ok := parseQueryDate(*bound)
+		if !ok {
+			return domain.NewCustomError(0, domain.ErrDate, fmt.Errorf("%q", *bound))
+		}
+		*bound = date
+	}
+	if filter.Period != "" {
+		from, to, ok := parsePeriod(filter.Period, now)
+		if !ok {
+			return domain.NewCustomError(0, domain.ErrPeriod,
+				domain.NewMessage("period_options", "%q, доступны: today, week, overdue, Nd", filter.Period))
+		}
+		narrowDates(filter, from, to)
+		filter.Period = ""
+	}
+	return nil
+}
+
+func narrowDates(filter *domain.Filter, from, to string) {
+	if from != "" && from > filter.From {
+		filter.From = from
+	}
+	if to != "" && (filter.To == "" || to < filter.To) {
+		filter.To = to
+	}
+}
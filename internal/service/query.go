@@ -0,0 +1,208 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Форматы дат, которые принимает due:
+var queryDateForms = []string{"2006-01-02", "02.01.2006", dateForm}
+
+var (
+	queryFieldName = regexp.MustCompile(`^[a-zA-Z]+$`)
+	queryTagValue  = regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
+)
+
+// QueryError описывает ошибку разбора с позицией (в символах, с единицы)
+type QueryError struct {
+	Pos int
+	Msg *domain.Message
+}
+
+func (e *QueryError) Error() string {
+	return e.Message().Error()
+}
+
+// Message - текст ошибки вместе с позицией для перевода
+func (e *QueryError) Message() *domain.Message {
+	return domain.NewMessage("query_position", "%s (позиция %d)", e.Msg, e.Pos)
+}
+
+// ParseQuery разбирает строку поиска вида
+//
+//	title:report tag:ops due:<2026-11-01 due:7d repeat:w status:open "exact phrase" -excluded
+//
+// Слова без поля ищутся в заголовке и комментарии, "-" перед условием его отрицает.
+// Периоды в due: (today, week, overdue, Nd) и status: отсчитываются от now.
+func ParseQuery(input string, now time.Time) (*domain.Query, error) {
+	p := &queryParser{input: []rune(input), now: now}
+	query := &domain.Query{Today: now.Format(dateForm)}
+	for {
+		p.skipSpaces()
+		if p.eof() {
+			break
+		}
+		term, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	return query, nil
+}
+
+type queryParser struct {
+	input []rune
+	pos   int
+	now   time.Time
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *queryParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) errorf(pos int, code, format string, args ...any) error {
+	return &QueryError{Pos: pos + 1, Msg: domain.NewMessage(code, format, args...)}
+}
+
+func (p *queryParser) term() (domain.QueryTerm, error) {
+	negate := false
+	if p.input[p.pos] == '-' && p.pos+1 < len(p.input) && !unicode.IsSpace(p.input[p.pos+1]) {
+		negate = true
+		p.pos++
+	}
+
+	if p.input[p.pos] == '"' {
+		phrase, err := p.quoted()
+		if err != nil {
+			return domain.QueryTerm{}, err
+		}
+		return domain.QueryTerm{Field: domain.FieldText, Op: domain.OpContains, Value: phrase, Phrase: true, Negate: negate}, nil
+	}
+
+	wordStart := p.pos
+	word := p.word()
+	name, value, hasField := strings.Cut(word, ":")
+	if !hasField || !queryFieldName.MatchString(name) {
+		return domain.QueryTerm{Field: domain.FieldText, Op: domain.OpContains, Value: word, Negate: negate}, nil
+	}
+
+	valueStart := wordStart + len([]rune(name)) + 1
+	phrase := false
+	if value == "" && !p.eof() && p.input[p.pos] == '"' {
+		var err error
+		if value, err = p.quoted(); err != nil {
+			return domain.QueryTerm{}, err
+		}
+		phrase = true
+	}
+	if value == "" {
+		return domain.QueryTerm{}, p.errorf(valueStart, "query_value_required", "не указано значение для %q", name)
+	}
+
+	term, err := p.fieldTerm(strings.ToLower(name), value, wordStart, valueStart)
+	if err != nil {
+		return domain.QueryTerm{}, err
+	}
+	term.Phrase = phrase
+	term.Negate = negate
+	return term, nil
+}
+
+func (p *queryParser) fieldTerm(name, value string, namePos, valuePos int) (domain.QueryTerm, error) {
+	switch domain.QueryField(name) {
+	case domain.FieldTitle, domain.FieldComment:
+		return domain.QueryTerm{Field: domain.QueryField(name), Op: domain.OpContains, Value: value}, nil
+	case domain.FieldTag:
+		value = strings.ToLower(strings.TrimPrefix(value, "#"))
+		if !queryTagValue.MatchString(value) {
+			return domain.QueryTerm{}, p.errorf(valuePos, "query_tag", "тег %q может содержать только буквы, цифры, _ и -", value)
+		}
+		return domain.QueryTerm{Field: domain.FieldTag, Op: domain.OpContains, Value: value}, nil
+	case domain.FieldDue:
+		op, rest := splitDateOp(value)
+		if date, ok := parseQueryDate(rest); ok {
+			return domain.QueryTerm{Field: domain.FieldDue, Op: op, Value: date}, nil
+		}
+		// Период, как в параметре period, но без оператора сравнения: due:today, due:7d
+		if op == domain.OpEq && !strings.HasPrefix(value, string(domain.OpEq)) {
+			if from, to, ok := parsePeriod(rest, p.now); ok {
+				return domain.QueryTerm{Field: domain.FieldDue, Op: domain.OpBetween, Value: from + string(domain.OpBetween) + to}, nil
+			}
+		}
+		return domain.QueryTerm{}, p.errorf(valuePos, "query_date",
+			"некорректная дата %q, ожидается ГГГГ-ММ-ДД, ДД.ММ.ГГГГ или период today, week, overdue, Nd", rest)
+	case domain.FieldRepeat:
+		value = strings.ToLower(value)
+		switch value {
+		case "d", "w", "m", "y", domain.RepeatNone:
+			return domain.QueryTerm{Field: domain.FieldRepeat, Op: domain.OpEq, Value: value}, nil
+		}
+		return domain.QueryTerm{}, p.errorf(valuePos, "query_repeat", "неизвестный вид повторения %q, доступны: d, w, m, y, none", value)
+	case domain.FieldStatus:
+		value = strings.ToLower(value)
+		switch value {
+		case domain.StatusOpen, domain.StatusOverdue:
+			return domain.QueryTerm{Field: domain.FieldStatus, Op: domain.OpEq, Value: value}, nil
+		}
+		return domain.QueryTerm{}, p.errorf(valuePos, "query_status", "неизвестный статус %q, доступны: open, overdue", value)
+	}
+	return domain.QueryTerm{}, p.errorf(namePos, "query_field",
+		"неизвестное поле %q, доступны: title, comment, tag, due, repeat, status; текст с двоеточием возьмите в кавычки", name)
+}
+
+// word читает слово до пробела или кавычки
+func (p *queryParser) word() string {
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(p.input[p.pos]) && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+// quoted читает фразу в двойных кавычках
+func (p *queryParser) quoted() (string, error) {
+	open := p.pos
+	p.pos++
+	start := p.pos
+	for !p.eof() && p.input[p.pos] != '"' {
+		p.pos++
+	}
+	if p.eof() {
+		return "", p.errorf(open, "query_unclosed_quote", "не закрыта кавычка")
+	}
+	phrase := strings.TrimSpace(string(p.input[start:p.pos]))
+	p.pos++
+	if phrase == "" {
+		return "", p.errorf(open, "query_empty_phrase", "пустая фраза в кавычках")
+	}
+	return phrase, nil
+}
+
+func splitDateOp(value string) (domain.QueryOp, string) {
+	for _, op := range []domain.QueryOp{domain.OpLte, domain.OpGte, domain.OpLt, domain.OpGt, domain.OpEq} {
+		if rest, ok := strings.CutPrefix(value, string(op)); ok {
+			return op, rest
+		}
+	}
+	return domain.OpEq, value
+}
+
+func parseQueryDate(value string) (string, bool) {
+	for _, form := range queryDateForms {
+		if date, err := time.Parse(form, value); err == nil {
+			return date.Format(dateForm), true
+		}
+	}
+	return "", false
+}
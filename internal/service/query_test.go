@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// queryNow - пятница 26.01.2024: от нее отсчитываются периоды в due:
+var queryNow = time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+
+func TestParseQuery(t *testing.T) {
+	text := func(value string) domain.QueryTerm {
+		return domain.QueryTerm{Field: domain.FieldText, Op: domain.OpContains, Value: value}
+	}
+	tests := []struct {
+		input string
+		want  []domain.QueryTerm
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"report", []domain.QueryTerm{text("report")}},
+		{"-report", []domain.QueryTerm{{Field: domain.FieldText, Op: domain.OpContains, Value: "report", Negate: true}}},
+		{`"exact  phrase "`, []domain.QueryTerm{{Field: domain.FieldText, Op: domain.OpContains, Value: "exact  phrase", Phrase: true}}},
+		{"Title:Report", []domain.QueryTerm{{Field: domain.FieldTitle, Op: domain.OpContains, Value: "Report"}}},
+		{`comment:"a b"`, []domain.QueryTerm{{Field: domain.FieldComment, Op: domain.OpContains, Value: "a b", Phrase: true}}},
+		{"tag:#Ops", []domain.QueryTerm{{Field: domain.FieldTag, Op: domain.OpContains, Value: "ops"}}},
+		{"tag:работа", []domain.QueryTerm{{Field: domain.FieldTag, Op: domain.OpContains, Value: "работа"}}},
+		{"due:<=2024-11-01", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpLte, Value: "20241101"}}},
+		{"due:>01.11.2024", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpGt, Value: "20241101"}}},
+		{"due:20241101", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpEq, Value: "20241101"}}},
+		{"due:=2024-11-01", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpEq, Value: "20241101"}}},
+		{"repeat:W", []domain.QueryTerm{{Field: domain.FieldRepeat, Op: domain.OpEq, Value: "w"}}},
+		{"-repeat:none", []domain.QueryTerm{{Field: domain.FieldRepeat, Op: domain.OpEq, Value: "none", Negate: true}}},
+		{"status:Overdue", []domain.QueryTerm{{Field: domain.FieldStatus, Op: domain.OpEq, Value: "overdue"}}},
+		// Периоды в due: разворачиваются в диапазон дат относительно now
+		{"due:today", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpBetween, Value: "20240126..20240126"}}},
+		{"due:Week", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpBetween, Value: "20240122..20240128"}}},
+		{"due:7d", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpBetween, Value: "20240126..20240201"}}},
+		{"-due:overdue", []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpBetween, Value: "..20240125", Negate: true}}},
+		{`due:"ближайшие 3 дня"`, []domain.QueryTerm{{Field: domain.FieldDue, Op: domain.OpBetween, Value: "20240126..20240128", Phrase: true}}},
+		// Двоеточие после не-буквенного имени - обычный текст
+		{"10:00", []domain.QueryTerm{text("10:00")}},
+		// Одиночный "-" перед пробелом - тоже текст, а не отрицание
+		{"- x", []domain.QueryTerm{text("-"), text("x")}},
+		{`a"b"`, []domain.QueryTerm{text("a"), {Field: domain.FieldText, Op: domain.OpContains, Value: "b", Phrase: true}}},
+		{"report tag:ops status:open", []domain.QueryTerm{
+			text("report"),
+			{Field: domain.FieldTag, Op: domain.OpContains, Value: "ops"},
+			{Field: domain.FieldStatus, Op: domain.OpEq, Value: "open"},
+		}},
+	}
+	for _, tt := range tests {
+		query, err := ParseQuery(tt.input, queryNow)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(query.Terms, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, ожидалось %+v", tt.input, query.Terms, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{"title:", 7, "не указано значение"},
+		{`"open phrase`, 1, "не закрыта кавычка"},
+		{`report ""`, 8, "пустая фраза"},
+		{"foo:bar", 1, "неизвестное поле"},
+		{"report due:2024-13-01", 12, "некорректная дата"},
+		{"due:<tomorrow", 5, "некорректная дата"},
+		// Период нельзя сравнивать и нельзя выходить за предел в днях
+		{"due:<today", 5, "некорректная дата"},
+		{"due:400d", 5, "некорректная дата"},
+		{"tag:a+b", 5, "тег"},
+		{"repeat:x", 8, "неизвестный вид повторения"},
+		{"status:done", 8, "неизвестный статус"},
+		// Позиция считается в символах, а не в байтах
+		{"отчет due:x", 11, "некорректная дата"},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.input, queryNow)
+		var qErr *QueryError
+		if !errors.As(err, &qErr) {
+			t.Errorf("ParseQuery(%q) = %v, ожидалась QueryError", tt.input, err)
+			continue
+		}
+		if qErr.Pos != tt.pos || !strings.Contains(qErr.Msg.Text, tt.msg) {
+			t.Errorf("ParseQuery(%q): позиция %d %q, ожидалось %d %q", tt.input, qErr.Pos, qErr.Msg, tt.pos, tt.msg)
+		}
+	}
+}
+
+// TestQueryMatchesTaskStore проверяет семантику языка поиска на наборе задач:
+// и сам Query.Match, и хранилище в памяти должны отобрать одни и те же задачи
+func TestQueryMatchesTaskStore(t *testing.T) {
+	const today = "20240126"
+	fixtures := []domain.Task{
+		{Date: "20240120", Title: "Quarterly report", Comment: "send to #ops", Tags: []string{"work"}},
+		{Date: "20240126", Title: "Buy milk", Repeat: "d 1"},
+		{Date: "20240201", Title: "Report review", Comment: "with team", Repeat: "w 1,3", Tags: []string{"ops"}},
+		{Date: "20240301", Title: "Отчет за месяц", Comment: "Подготовить отчёт", Repeat: "m 1", Tags: []string{"работа"}},
+		{Date: "20240615", Title: "Birthday", Comment: "call mom: 10:00", Repeat: "y"},
+	}
+	store := memory.NewTaskStore()
+	ctx := context.Background()
+	for i := range fixtures {
+		task := fixtures[i]
+		id, err := store.CreateTask(ctx, &task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures[i].ID = strconv.FormatInt(id, 10)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"report", []string{"1", "3"}},
+		{"REPORT", []string{"1", "3"}},
+		{"-report", []string{"2", "4", "5"}},
+		{"title:report", []string{"1", "3"}},
+		{"comment:team", []string{"3"}},
+		{"tag:ops", []string{"1", "3"}},
+		{"tag:работа", []string{"4"}},
+		{"отчет", []string{"4"}},
+		{"due:<2024-01-26", []string{"1"}},
+		{"due:>=26.01.2024", []string{"2", "3", "4", "5"}},
+		{"due:2024-02-01", []string{"3"}},
+		{"repeat:none", []string{"1"}},
+		{"repeat:w", []string{"3"}},
+		{"status:overdue", []string{"1"}},
+		{"status:open", []string{"2", "3", "4", "5"}},
+		{"due:today", []string{"2"}},
+		{"due:week", []string{"2"}},
+		{"due:7d", []string{"2", "3"}},
+		{"due:overdue", []string{"1"}},
+		{"-due:today", []string{"1", "3", "4", "5"}},
+		{`due:"next 40 days" report`, []string{"3"}},
+		{`"call mom"`, []string{"5"}},
+		{`comment:"mom: 10"`, []string{"5"}},
+		{"report status:open", []string{"3"}},
+		{"-tag:ops -repeat:none", []string{"2", "4", "5"}},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		query, err := ParseQuery(tt.query, queryNow)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+		}
+		if query.Today != today {
+			t.Fatalf("ParseQuery(%q): Today = %s", tt.query, query.Today)
+		}
+
+		var matched []string
+		for i := range fixtures {
+			if query.Match(&fixtures[i]) {
+				matched = append(matched, fixtures[i].ID)
+			}
+		}
+		tasks, err := store.FindTask(ctx, &domain.Filter{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored []string
+		for _, task := range tasks {
+			stored = append(stored, task.ID)
+		}
+		slices.Sort(stored)
+
+		if !slices.Equal(matched, tt.want) {
+			t.Errorf("Match(%q) = %v, ожидалось %v", tt.query, matched, tt.want)
+		}
+		if !slices.Equal(stored, tt.want) {
+			t.Errorf("TaskStore(%q) = %v, ожидалось %v", tt.query, stored, tt.want)
+		}
+	}
+}
+
+// Названия периодов в строке поиска ищутся как текст, а период
+// задается только отдельным параметром
+func TestSearchPeriodWordsAreText(t *testing.T) {
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	s := NewService(memory.NewTaskStore(), WithClock(FixedClock(now)))
+
+	for _, term := range []string{"today", "week", "overdue", "7d"} {
+		filter := &domain.Filter{SearchTerm: term}
+		if cErr := s.prepareFilter(context.Background(), filter); cErr != nil {
+			t.Fatal(cErr)
+		}
+		if filter.From != "" || filter.To != "" || filter.Query == nil {
+			t.Errorf("search=%q: From %q, To %q, запрос %v", term, filter.From, filter.To, filter.Query)
+		}
+	}
+
+	filter := &domain.Filter{Period: "today"}
+	if cErr := s.prepareFilter(context.Background(), filter); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if filter.From != "20240126" || filter.To != "20240126" {
+		t.Errorf("period=today: From %q, To %q", filter.From, filter.To)
+	}
+
+	// В строке поиска период задается условием due:
+	filter = &domain.Filter{SearchTerm: "due:7d отчет"}
+	if cErr := s.prepareFilter(context.Background(), filter); cErr != nil {
+		t.Fatal(cErr)
+	}
+	want := []domain.QueryTerm{
+		{Field: domain.FieldDue, Op: domain.OpBetween, Value: "20240126..20240201"},
+		{Field: domain.FieldText, Op: domain.OpContains, Value: "отчет"},
+	}
+	if filter.Query == nil || !reflect.DeepEqual(filter.Query.Terms, want) {
+		t.Errorf("search=due:7d: запрос %+v", filter.Query)
+	}
+}
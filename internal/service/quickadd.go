@@ -0,0 +1,373 @@
+package service
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Быстрое добавление: из строки вроде "Pay rent every month on the 1st #home !high"
+// или "Позвонить маме завтра" извлекаются повторение, дата, теги и приоритет,
+// остаток становится заголовком. Фразы ищутся как отдельные слова, поэтому
+// строка дополняется пробелами по краям, а найденная фраза заменяется пробелом.
+
+const (
+	enWeekday  = `(?:mon|tues|wednes|thurs|fri|satur|sun)day`
+	enWeekdays = enWeekday + `s?(?:\s*(?:,|and|&)\s*` + enWeekday + `s?)*`
+	ruWeekday  = `(?:понедельник(?:а|ам|и)?|вторник(?:а|ам|и)?|сред(?:а|у|ы|ам)|четверг(?:а|ам|и)?|` +
+		`пятниц(?:а|у|ы|ам)|суббот(?:а|у|ы|ам)|воскресень(?:е|я|ям))`
+	ruWeekdays = ruWeekday + `(?:\s*(?:,|и)\s*` + ruWeekday + `)*`
+	enMonth    = `(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|` +
+		`sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)`
+	ruMonth = `(?:января|февраля|марта|апреля|мая|июня|июля|августа|сентября|октября|ноября|декабря)`
+	ordinal = `(\d{1,2})(?:st|nd|rd|th)?`
+	ruDays  = `(?:дн(?:я|ей)|день)`
+	ruWeeks = `недел(?:и|ь|ю)`
+)
+
+var (
+	quickTag      = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_-]+)`)
+	quickPriority = regexp.MustCompile(`(?i)\s(!{1,3}|!(?:high|medium|low|h|m|l|высокий|средний|низкий|важно|срочно))\s`)
+	quickWeekday  = regexp.MustCompile(`(?i)` + enWeekday + `|` + ruWeekday)
+)
+
+type quickRule struct {
+	re    *regexp.Regexp
+	apply func(q *quickAdd, groups []string) error
+}
+
+func phrase(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\s(?:` + pattern + `)\s`)
+}
+
+// Правила повторения проверяются до дат, чтобы "every monday" не стало датой
+var repeatRules = []quickRule{
+	{phrase(`(?:every|each)\s+(\d{1,3})\s+days?|кажд(?:ые|ый)\s+(\d{1,3})\s+` + ruDays), func(q *quickAdd, g []string) error {
+		return q.setDays(g[0], 1)
+	}},
+	{phrase(`(?:every|each)\s+(\d{1,2})\s+weeks?|кажд(?:ые|ую)\s+(\d{1,2})\s+` + ruWeeks), func(q *quickAdd, g []string) error {
+		return q.setDays(g[0], 7)
+	}},
+	{phrase(`every\s+other\s+day|через\s+день`), func(q *quickAdd, _ []string) error {
+		q.task.Repeat = "d 2"
+		return nil
+	}},
+	{phrase(`daily|(?:every|each)\s+day|каждый\s+день|ежедневно`), func(q *quickAdd, _ []string) error {
+		q.task.Repeat = "d 1"
+		return nil
+	}},
+	{phrase(`every\s+weekday|on\s+weekdays|по\s+будням|каждый\s+будний\s+день`), func(q *quickAdd, _ []string) error {
+		q.task.Repeat = "w 1,2,3,4,5"
+		return nil
+	}},
+	{phrase(`(?:every|each)\s+(` + enWeekdays + `)|(?:кажд(?:ый|ую|ое)|по)\s+(` + ruWeekdays + `)`), func(q *quickAdd, g []string) error {
+		q.task.Repeat = "w " + weekdayList(g[0])
+		return nil
+	}},
+	{phrase(`(?:every|each)\s+month\s+on\s+the\s+last\s+day|(?:on\s+)?the\s+last\s+day\s+of\s+(?:every|each)\s+month|` +
+		`(?:в\s+)?последний\s+день\s+(?:каждого\s+месяца|месяца)`), func(q *quickAdd, _ []string) error {
+		q.task.Repeat = "m -1"
+		return nil
+	}},
+	{phrase(`(?:(?:every|each)\s+month|monthly)\s+on\s+(?:the\s+)?` + ordinal + `|(?:on\s+)?the\s+` + ordinal + `\s+of\s+(?:every|each)\s+month|` +
+		`(?:каждый\s+месяц|ежемесячно)\s+(\d{1,2})(?:-?го)?(?:\s+числа)?|кажд(?:ое|ого)\s+(\d{1,2})(?:-?го|-?е)?\s+числ(?:о|а)(?:\s+месяца)?`),
+		func(q *quickAdd, g []string) error {
+			day, err := strconv.Atoi(g[0])
+			if err != nil || day < 1 || day > 31 {
+				return domain.NewMessage("quick_add_month_day", "день месяца %q должен быть от 1 до 31", g[0])
+			}
+			q.task.Repeat = "m " + strconv.Itoa(day)
+			return nil
+		}},
+	{phrase(`(?:every|each)\s+month|monthly|каждый\s+месяц|ежемесячно`), func(q *quickAdd, _ []string) error {
+		q.repeatFromDate = "m"
+		return nil
+	}},
+	{phrase(`(?:every|each)\s+week|weekly|каждую\s+неделю|еженедельно`), func(q *quickAdd, _ []string) error {
+		q.repeatFromDate = "w"
+		return nil
+	}},
+	{phrase(`(?:every|each)\s+year|yearly|annually|каждый\s+год|ежегодно`), func(q *quickAdd, _ []string) error {
+		q.task.Repeat = "y"
+		return nil
+	}},
+}
+
+var dateRules = []quickRule{
+	{phrase(`(?:on\s+)?(\d{1,2}\.\d{1,2}\.\d{4})|(?:on\s+)?(\d{4}-\d{2}-\d{2})`), func(q *quickAdd, g []string) error {
+		date, ok := parseQueryDate(g[0])
+		if !ok {
+			return domain.NewMessage("quick_add_date", "некорректная дата %q", g[0])
+		}
+		q.task.Date = date
+		return nil
+	}},
+	{phrase(`(?:the\s+)?day\s+after\s+tomorrow|послезавтра`), func(q *quickAdd, _ []string) error {
+		return q.setOffset(2)
+	}},
+	{phrase(`today|tonight|сегодня`), func(q *quickAdd, _ []string) error {
+		return q.setOffset(0)
+	}},
+	{phrase(`tomorrow|завтра`), func(q *quickAdd, _ []string) error {
+		return q.setOffset(1)
+	}},
+	{phrase(`in\s+(\d{1,3})\s+days?|через\s+(\d{1,3})\s+` + ruDays), func(q *quickAdd, g []string) error {
+		n, _ := strconv.Atoi(g[0])
+		return q.setOffset(n)
+	}},
+	{phrase(`in\s+(\d{1,2})\s+weeks?|через\s+(\d{1,2})\s+` + ruWeeks), func(q *quickAdd, g []string) error {
+		n, _ := strconv.Atoi(g[0])
+		return q.setOffset(7 * n)
+	}},
+	{phrase(`in\s+a\s+week|через\s+неделю`), func(q *quickAdd, _ []string) error {
+		return q.setOffset(7)
+	}},
+	{phrase(`next\s+week|на\s+следующей\s+неделе`), func(q *quickAdd, _ []string) error {
+		return q.setWeekday(time.Monday)
+	}},
+	{phrase(`(?:(?:on|next|this)\s+)?(` + enWeekday + `)|(?:в|во)\s+(?:(?:эт(?:от|у|о)|следующ(?:ий|ую|ее))\s+)?(` + ruWeekday + `)`),
+		func(q *quickAdd, g []string) error {
+			day, _ := weekdayOf(g[0])
+			return q.setWeekday(day)
+		}},
+	{phrase(`(?:on\s+)?` + ordinal + `\s+(?:of\s+)?(` + enMonth + `)(?:\s+(\d{4}))?|(?:on\s+)?(` + enMonth + `)\s+` + ordinal + `(?:,?\s+(\d{4}))?|` +
+		`(\d{1,2})(?:-?го)?\s+(` + ruMonth + `)(?:\s+(\d{4})(?:\s+(?:года|г\.?))?)?`),
+		func(q *quickAdd, g []string) error {
+			return q.setDayMonth(g)
+		}},
+}
+
+type quickAdd struct {
+	text string
+	now  time.Time
+	task domain.Task
+	// repeatFromDate - "every week" или "every month": правило строится по дате задачи
+	repeatFromDate string
+}
+
+// QuickAddPreview разбирает строку быстрого добавления и проверяет задачу
+// так же, как Create, но не сохраняет ее
+func (s *TaskService) QuickAddPreview(ctx context.Context, text string) (*domain.Task, *domain.CustomError) {
+	task, err := s.parseQuickAdd(text, s.Now(ctx))
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrQuickAdd, err)
+	}
+	if cErr := s.prepareTask(ctx, task); cErr != nil {
+		return nil, cErr
+	}
+	return task, nil
+}
+
+// QuickAdd разбирает строку быстрого добавления и создает задачу
+func (s *TaskService) QuickAdd(ctx context.Context, text string) (*domain.Task, *domain.CustomError) {
+	task, err := s.parseQuickAdd(text, s.Now(ctx))
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrQuickAdd, err)
+	}
+	id, cErr := s.Create(ctx, task)
+	if cErr != nil {
+		return nil, cErr
+	}
+	task.ID = strconv.FormatInt(id, 10)
+	return task, nil
+}
+
+// parseQuickAdd разбирает строку быстрого добавления на русском или английском
+func (s *TaskService) parseQuickAdd(text string, now time.Time) (*domain.Task, error) {
+	q := &quickAdd{text: " " + strings.Join(strings.Fields(text), " ") + " ", now: now}
+
+	for _, m := range quickTag.FindAllStringSubmatch(q.text, -1) {
+		q.task.Tags = append(q.task.Tags, strings.ToLower(m[1]))
+	}
+	q.text = quickTag.ReplaceAllString(q.text, " ")
+
+	if m := quickPriority.FindStringSubmatchIndex(q.text); m != nil {
+		q.task.Priority = priorityOf(q.text[m[2]:m[3]])
+		q.text = q.text[:m[0]] + " " + q.text[m[1]:]
+	}
+	if err := q.applyFirst(repeatRules); err != nil {
+		return nil, err
+	}
+	if err := q.applyFirst(dateRules); err != nil {
+		return nil, err
+	}
+	q.completeRepeat()
+
+	q.task.Title = strings.Join(strings.Fields(q.text), " ")
+	return &q.task, nil
+}
+
+// applyFirst применяет первое подходящее правило и вырезает фразу из текста
+func (q *quickAdd) applyFirst(rules []quickRule) error {
+	for _, rule := range rules {
+		m := rule.re.FindStringSubmatchIndex(q.text)
+		if m == nil {
+			continue
+		}
+		var groups []string
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				groups = append(groups, q.text[m[i]:m[i+1]])
+			}
+		}
+		phrase := strings.TrimSpace(q.text[m[0]:m[1]])
+		if err := rule.apply(q, groups); err != nil {
+			return domain.NewMessage("quick_add_phrase", "%q: %s", phrase, err)
+		}
+		q.text = q.text[:m[0]] + " " + q.text[m[1]:]
+		return nil
+	}
+	return nil
+}
+
+// completeRepeat строит правило "every week/month" по дате задачи, а для
+// повторения без даты выбирает первую дату по правилу, начиная с сегодняшней
+func (q *quickAdd) completeRepeat() {
+	date := q.now
+	if q.task.Date != "" {
+		date, _ = time.Parse(dateForm, q.task.Date)
+	}
+	switch q.repeatFromDate {
+	case "w":
+		q.task.Repeat = "w " + strconv.Itoa(isoWeekday(date.Weekday()))
+	case "m":
+		q.task.Repeat = "m " + strconv.Itoa(date.Day())
+	}
+	if q.task.Date != "" || q.task.Repeat == "" {
+		return
+	}
+	rule, err := domain.ParseRepeat(q.task.Repeat)
+	if err != nil || rule.Kind != domain.RepeatWeekly && rule.Kind != domain.RepeatMonthly {
+		return
+	}
+	yesterday := q.now.AddDate(0, 0, -1)
+	if next, err := rule.Next(yesterday, yesterday); err == nil {
+		q.task.Date = next.Format(dateForm)
+	}
+}
+
+func (q *quickAdd) setDays(raw string, mult int) error {
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 || n*mult > domain.MaxRepeatDays {
+		return domain.NewMessage("quick_add_interval", "интервал должен быть от 1 до %d дней", domain.MaxRepeatDays)
+	}
+	q.task.Repeat = "d " + strconv.Itoa(n*mult)
+	return nil
+}
+
+func (q *quickAdd) setOffset(days int) error {
+	q.task.Date = q.now.AddDate(0, 0, days).Format(dateForm)
+	return nil
+}
+
+// setWeekday выбирает ближайший такой день недели после сегодняшнего
+func (q *quickAdd) setWeekday(day time.Weekday) error {
+	offset := (int(day) - int(q.now.Weekday()) + 7) % 7
+	if offset == 0 {
+		offset = 7
+	}
+	return q.setOffset(offset)
+}
+
+// setDayMonth разбирает "5 march", "march 5th" и "5 марта"; без года берется
+// ближайшая такая дата, начиная с сегодняшней
+func (q *quickAdd) setDayMonth(g []string) error {
+	var dayRaw, monthRaw, yearRaw string
+	if _, err := strconv.Atoi(g[0]); err == nil {
+		dayRaw, monthRaw = g[0], g[1]
+	} else {
+		monthRaw, dayRaw = g[0], g[1]
+	}
+	if len(g) > 2 {
+		yearRaw = g[2]
+	}
+	day, _ := strconv.Atoi(dayRaw)
+	month := monthOf(monthRaw)
+	year := q.now.Year()
+	if yearRaw != "" {
+		year, _ = strconv.Atoi(yearRaw)
+	}
+	date := time.Date(year, month, day, 0, 0, 0, 0, q.now.Location())
+	if date.Day() != day {
+		return domain.NewMessage("quick_add_no_day", "в месяце нет %d-го числа", day)
+	}
+	if yearRaw == "" && date.Format(dateForm) < q.now.Format(dateForm) {
+		date = date.AddDate(1, 0, 0)
+	}
+	q.task.Date = date.Format(dateForm)
+	return nil
+}
+
+func priorityOf(raw string) int {
+	switch strings.ToLower(strings.TrimPrefix(raw, "!")) {
+	case "high", "h", "высокий", "важно", "срочно", "!!":
+		return domain.PriorityHigh
+	case "medium", "m", "средний", "!":
+		return domain.PriorityMedium
+	default:
+		return domain.PriorityLow
+	}
+}
+
+// weekdayOf определяет день недели по английскому или русскому названию в любой форме
+func weekdayOf(word string) (time.Weekday, bool) {
+	word = strings.ToLower(word)
+	prefixes := []struct {
+		prefix string
+		day    time.Weekday
+	}{
+		{"mon", time.Monday}, {"tue", time.Tuesday}, {"wed", time.Wednesday}, {"thu", time.Thursday},
+		{"fri", time.Friday}, {"sat", time.Saturday}, {"sun", time.Sunday},
+		{"пон", time.Monday}, {"вто", time.Tuesday}, {"сре", time.Wednesday}, {"чет", time.Thursday},
+		{"пят", time.Friday}, {"суб", time.Saturday}, {"вос", time.Sunday},
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(word, p.prefix) {
+			return p.day, true
+		}
+	}
+	return 0, false
+}
+
+// weekdayList переводит перечень дней недели в формат правила w: 1 - понедельник, 7 - воскресенье
+func weekdayList(list string) string {
+	var days []int
+	for _, word := range quickWeekday.FindAllString(list, -1) {
+		if day, ok := weekdayOf(word); ok && !slices.Contains(days, isoWeekday(day)) {
+			days = append(days, isoWeekday(day))
+		}
+	}
+	res := make([]string, 0, len(days))
+	for _, day := range days {
+		res = append(res, strconv.Itoa(day))
+	}
+	return strings.Join(res, ",")
+}
+
+func isoWeekday(day time.Weekday) int {
+	if day == time.Sunday {
+		return 7
+	}
+	return int(day)
+}
+
+func monthOf(word string) time.Month {
+	word = strings.ToLower(word)
+	ru := []string{"янв", "фев", "мар", "апр", "мая", "июн", "июл", "авг", "сен", "окт", "ноя", "дек"}
+	for i, prefix := range ru {
+		if strings.HasPrefix(word, prefix) {
+			return time.Month(i + 1)
+		}
+	}
+	for m := time.January; m <= time.December; m++ {
+		if strings.HasPrefix(strings.ToLower(m.String()), word[:3]) {
+			return m
+		}
+	}
+	return time.January
+}
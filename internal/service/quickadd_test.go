@@ -0,0 +1,97 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+func TestParseQuickAdd(t *testing.T) {
+	// Пятница, 26 января 2024
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		text     string
+		title    string
+		date     string
+		repeat   string
+		tags     []string
+		priority int
+	}{
+		// Примеры из запроса
+		{"Pay rent every month on the 1st #home !high", "Pay rent", "20240201", "m 1", []string{"home"}, domain.PriorityHigh},
+		{"Позвонить маме завтра", "Позвонить маме", "20240127", "", nil, domain.PriorityNone},
+
+		// Повторение разбирается раньше даты: "every monday" - правило, а не дата
+		{"Standup every monday", "Standup", "20240129", "w 1", nil, domain.PriorityNone},
+		{"Review every week on friday", "Review", "20240202", "w 5", nil, domain.PriorityNone},
+		{"Report on friday", "Report", "20240202", "", nil, domain.PriorityNone},
+		{"Pay bills every 2 weeks", "Pay bills", "", "d 14", nil, domain.PriorityNone},
+		{"Water plants every other day", "Water plants", "", "d 2", nil, domain.PriorityNone},
+		{"Rent on the last day of every month", "Rent", "20240131", "m -1", nil, domain.PriorityNone},
+		{"Налоги каждое 15 число", "Налоги", "20240215", "m 15", nil, domain.PriorityNone},
+
+		// Перечни дней недели
+		{"Gym every monday, wednesday and friday", "Gym", "20240126", "w 1,3,5", nil, domain.PriorityNone},
+		{"Gym every tuesdays & thursdays", "Gym", "20240130", "w 2,4", nil, domain.PriorityNone},
+		{"Бассейн по понедельникам и средам", "Бассейн", "20240129", "w 1,3", nil, domain.PriorityNone},
+		{"Встреча в следующую среду", "Встреча", "20240131", "", nil, domain.PriorityNone},
+
+		// Приоритет: чем больше восклицательных знаков, тем выше
+		{"Buy milk !", "Buy milk", "", "", nil, domain.PriorityLow},
+		{"Buy milk !!", "Buy milk", "", "", nil, domain.PriorityMedium},
+		{"Buy milk !!!", "Buy milk", "", "", nil, domain.PriorityHigh},
+		{"Купить хлеб !срочно", "Купить хлеб", "", "", nil, domain.PriorityHigh},
+		{"Hello! world", "Hello! world", "", "", nil, domain.PriorityNone},
+
+		// Названия месяцев; дата без года - ближайшая, начиная с сегодня
+		{"Dentist march 5th", "Dentist", "20240305", "", nil, domain.PriorityNone},
+		{"Dentist on 5 march", "Dentist", "20240305", "", nil, domain.PriorityNone},
+		{"Party dec 31, 2024", "Party", "20241231", "", nil, domain.PriorityNone},
+		{"Отпуск 5 января", "Отпуск", "20250105", "", nil, domain.PriorityNone},
+		{"Отчет 26 января", "Отчет", "20240126", "", nil, domain.PriorityNone},
+		{"Сдать проект 1-го июня 2024 года", "Сдать проект", "20240601", "", nil, domain.PriorityNone},
+
+		// Относительные даты и теги
+		{"Release in 2 weeks #Work #urgent", "Release", "20240209", "", []string{"work", "urgent"}, domain.PriorityNone},
+		{"Уборка послезавтра", "Уборка", "20240128", "", nil, domain.PriorityNone},
+		{"Отчет 01.02.2024", "Отчет", "20240201", "", nil, domain.PriorityNone},
+		{"Plain title", "Plain title", "", "", nil, domain.PriorityNone},
+	}
+	s := &TaskService{}
+	for _, tt := range tests {
+		task, err := s.parseQuickAdd(tt.text, now)
+		if err != nil {
+			t.Errorf("parseQuickAdd(%q): %v", tt.text, err)
+			continue
+		}
+		if task.Title != tt.title || task.Date != tt.date || task.Repeat != tt.repeat ||
+			!slices.Equal(task.Tags, tt.tags) || task.Priority != tt.priority {
+			t.Errorf("parseQuickAdd(%q) = {%q %s %q %v %d}, ожидалось {%q %s %q %v %d}", tt.text,
+				task.Title, task.Date, task.Repeat, task.Tags, task.Priority,
+				tt.title, tt.date, tt.repeat, tt.tags, tt.priority)
+		}
+	}
+}
+
+func TestParseQuickAddErrors(t *testing.T) {
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		text string
+		msg  string
+	}{
+		{"Встреча 31 февраля", "нет 31-го числа"},
+		{"Check every 0 days", "интервал"},
+		{"Pay every month on the 32nd", "от 1 до 31"},
+		{"Отчет 31.02.2024", "некорректная дата"},
+	}
+	s := &TaskService{}
+	for _, tt := range tests {
+		_, err := s.parseQuickAdd(tt.text, now)
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("parseQuickAdd(%q) = %v, ожидалась ошибка %q", tt.text, err, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Сколько ближайших дат показывать в предпросмотре правила
+const maxRepeatPreview = 10
+
+// RepeatPreview разбирает правило повторения и возвращает ближайшие count
+// дат для задачи с датой start (пустая start - сегодня). Для пустого правила
+// возвращает nil: задача не повторяется.
+func (s *TaskService) RepeatPreview(ctx context.Context, repeat, start string, count int) (*domain.RepeatRule, []string, *domain.CustomError) {
+	var v taskValidator
+	v.repeat(repeat)
+	v.date(start)
+	if cErr := v.err(); cErr != nil {
+		return nil, nil, cErr
+	}
+	if v.rule == nil {
+		return nil, nil, nil
+	}
+
+	now := s.Now(ctx)
+	date := now
+	if start != "" {
+		date, _ = time.Parse(dateForm, start)
+	}
+	count = min(max(count, 0), maxRepeatPreview)
+	dates := make([]string, 0, count)
+	after := now
+	for len(dates) < count {
+		next, err := v.rule.Next(date, after)
+		if err != nil {
+			break
+		}
+		dates = append(dates, next.Format(dateForm))
+		after = next
+	}
+	return v.rule, dates, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+const maxFilterName int = 128
+
+// SavedFilterService управляет именованными фильтрами и выполняет их
+// через TaskService, так что сохраненный фильтр ведет себя как обычный поиск
+type SavedFilterService struct {
+	repo  domain.SavedFilterRepository
+	tasks *TaskService
+}
+
+func NewSavedFilterService(repo domain.SavedFilterRepository, tasks *TaskService) *SavedFilterService {
+	return &SavedFilterService{repo: repo, tasks: tasks}
+}
+
+func (s *SavedFilterService) Create(ctx context.Context, filter *domain.SavedFilter) (int64, *domain.CustomError) {
+	if cErr := s.validate(ctx, filter); cErr != nil {
+		return 0, cErr
+	}
+	id, err := s.repo.CreateSavedFilter(ctx, filter)
+	if err != nil {
+		return 0, filterStorageError(err)
+	}
+	filter.ID = id
+	return id, nil
+}
+
+func (s *SavedFilterService) Get(ctx context.Context, id int64) (*domain.SavedFilter, *domain.CustomError) {
+	filter, err := s.repo.GetSavedFilter(ctx, id)
+	if err != nil {
+		return nil, filterStorageError(err)
+	}
+	return filter, nil
+}
+
+func (s *SavedFilterService) List(ctx context.Context) ([]*domain.SavedFilter, *domain.CustomError) {
+	filters, err := s.repo.ListSavedFilters(ctx)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return filters, nil
+}
+
+func (s *SavedFilterService) Update(ctx context.Context, filter *domain.SavedFilter) *domain.CustomError {
+	if cErr := s.validate(ctx, filter); cErr != nil {
+		return cErr
+	}
+	if err := s.repo.UpdateSavedFilter(ctx, filter); err != nil {
+		return filterStorageError(err)
+	}
+	return nil
+}
+
+func (s *SavedFilterService) Delete(ctx context.Context, id int64) *domain.CustomError {
+	if err := s.repo.DeleteSavedFilter(ctx, id); err != nil {
+		return filterStorageError(err)
+	}
+	return nil
+}
+
+// Run выполняет сохраненный фильтр. limit и cursor задаются на каждый запрос,
+// limit из фильтра используется, если limit не передан.
+func (s *SavedFilterService) Run(ctx context.Context, id int64, limit int, cursor string) (*domain.TaskPage, *domain.CustomError) {
+	saved, cErr := s.Get(ctx, id)
+	if cErr != nil {
+		return nil, cErr
+	}
+	filter := saved.Filter
+	if limit > 0 {
+		filter.Limit = limit
+	}
+	filter.Cursor = cursor
+	return s.tasks.FindPage(ctx, &filter)
+}
+
+// Counts считает задачи во всех сохраненных фильтрах
+func (s *SavedFilterService) Counts(ctx context.Context) ([]domain.FilterCount, *domain.CustomError) {
+	filters, cErr := s.List(ctx)
+	if cErr != nil {
+		return nil, cErr
+	}
+	prepared := make([]*domain.Filter, 0, len(filters))
+	for _, saved := range filters {
+		filter := saved.Filter
+		prepared = append(prepared, &filter)
+	}
+	totals, cErr := s.tasks.Count(ctx, prepared)
+	if cErr != nil {
+		return nil, cErr
+	}
+	counts := make([]domain.FilterCount, 0, len(filters))
+	for i, saved := range filters {
+		counts = append(counts, domain.FilterCount{ID: saved.ID, Name: saved.Name, Count: totals[i]})
+	}
+	return counts, nil
+}
+
+// validate проверяет имя и пробно разбирает фильтр, чтобы ошибка в запросе
+// обнаружилась при сохранении, а не при каждом запуске
+func (s *SavedFilterService) validate(ctx context.Context, saved *domain.SavedFilter) *domain.CustomError {
+	saved.Name = strings.TrimSpace(saved.Name)
+	if saved.Name == "" || len([]rune(saved.Name)) > maxFilterName {
+		return domain.NewCustomError(0, domain.ErrFilterName, nil)
+	}
+	if saved.Filter.Limit < 0 {
+		return domain.NewCustomError(0, domain.ErrLimit, nil)
+	}
+	probe := saved.Filter
+	return s.tasks.prepareFilter(ctx, &probe)
+}
+
+func filterStorageError(err error) *domain.CustomError {
+	switch {
+	case errors.Is(err, domain.ErrFilterNotFound):
+		return domain.NewCustomError(0, domain.ErrFilterNotFound, nil)
+	case errors.Is(err, domain.ErrFilterExists):
+		// Имя ограничения и текст БД наружу не отдаем
+		return domain.NewCustomError(0, domain.ErrFilterExists, nil)
+	}
+	return domain.NewCustomError(0, domain.ErrInternalServer, err)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// savedFilters - сохраненные фильтры в памяти для тестов
+type savedFilters []*domain.SavedFilter
+
+func (f savedFilters) CreateSavedFilter(context.Context, *domain.SavedFilter) (int64, error) {
+	return 0, nil
+}
+
+func (f savedFilters) GetSavedFilter(context.Context, int64) (*domain.SavedFilter, error) {
+	return nil, domain.ErrFilterNotFound
+}
+
+func (f savedFilters) ListSavedFilters(context.Context) ([]*domain.SavedFilter, error) {
+	return f, nil
+}
+
+func (f savedFilters) UpdateSavedFilter(context.Context, *domain.SavedFilter) error {
+	return nil
+}
+
+func (f savedFilters) DeleteSavedFilter(context.Context, int64) error {
+	return nil
+}
+
+// countingStore считает обращения к CountTasks
+type countingStore struct {
+	*memory.TaskStore
+	calls int
+}
+
+func (s *countingStore) CountTasks(ctx context.Context, filters []*domain.Filter) ([]int, error) {
+	s.calls++
+	return s.TaskStore.CountTasks(ctx, filters)
+}
+
+func TestFilterCountsSingleQuery(t *testing.T) {
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	store := &countingStore{TaskStore: memory.NewTaskStore()}
+	ctx := context.Background()
+	for _, task := range []domain.Task{
+		{Date: "20240120", Title: "Quarterly report", Tags: []string{"work"}},
+		{Date: "20240126", Title: "Buy milk"},
+		{Date: "20240201", Title: "Report review", Tags: []string{"work"}},
+	} {
+		if _, err := store.CreateTask(ctx, &task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filters := savedFilters{
+		{ID: 1, Name: "all"},
+		{ID: 2, Name: "work", Filter: domain.Filter{SearchTerm: "tag:work"}},
+		{ID: 3, Name: "today", Filter: domain.Filter{Period: "today"}},
+		{ID: 4, Name: "overdue reports", Filter: domain.Filter{SearchTerm: "report status:overdue"}},
+	}
+	s := NewSavedFilterService(filters, NewService(store, WithClock(FixedClock(now))))
+
+	counts, cErr := s.Counts(ctx)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	var got []int
+	for _, c := range counts {
+		got = append(got, c.Count)
+	}
+	if want := []int{3, 2, 1, 1}; !slices.Equal(got, want) {
+		t.Errorf("Counts = %v, ожидалось %v", got, want)
+	}
+	if store.calls != 1 {
+		t.Errorf("CountTasks вызван %d раз, ожидался один запрос", store.calls)
+	}
+}
@@ -4,20 +4,57 @@ import (
 	"context"
 	"errors"
 	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"slices"
 	"strconv"
-	"strings"
 	"time"
 )
 
-const limitSearch int = 25
 const dateForm string = "20060102"
 
+// Размер страницы списка задач по умолчанию и его верхняя граница
+const (
+	defaultPageSize int = 25
+	defaultMaxPage  int = 100
+)
+
 type TaskService struct {
-	repo domain.TaskRepository
+	repo        domain.TaskRepository
+	pageSize    int
+	maxPageSize int
+	clock       Clock
+	metrics     TaskMetrics
 }
 
-func NewService(repo domain.TaskRepository) *TaskService {
-	return &TaskService{repo: repo}
+type ServiceOption func(*TaskService)
+
+func NewService(repo domain.TaskRepository, opts ...ServiceOption) *TaskService {
+	s := &TaskService{
+		repo:        repo,
+		pageSize:    defaultPageSize,
+		maxPageSize: defaultMaxPage,
+		clock:       SystemClock,
+		metrics:     nopMetrics{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithPageSize задает размер страницы по умолчанию и максимальный размер,
+// который может запросить клиент
+func WithPageSize(size, max int) ServiceOption {
+	return func(s *TaskService) {
+		if size > 0 {
+			s.pageSize = size
+		}
+		if max > 0 {
+			s.maxPageSize = max
+		}
+		if s.pageSize > s.maxPageSize {
+			s.pageSize = s.maxPageSize
+		}
+	}
 }
 
 func (s *TaskService) CloseDB() {
@@ -25,312 +62,315 @@ func (s *TaskService) CloseDB() {
 }
 
 func (s *TaskService) FindAll(ctx context.Context, filter *domain.Filter) ([]*domain.Task, *domain.CustomError) {
-	switch {
-	case filter.ID != nil:
+	if filter.ID != nil {
 		res, err := s.repo.FindTask(ctx, filter)
 		if err != nil {
 			return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
 		}
 		if len(res) == 0 {
-			return nil, domain.NewCustomError(0, domain.ErrID, nil)
+			return nil, domain.NewCustomError(0, domain.ErrNotFound, nil)
 		}
 		return res, nil
-	case filter.SearchTerm != "":
-		filter.Limit = limitSearch
-		if date, err := time.Parse("02.01.2006", filter.SearchTerm); err == nil {
-			filter.Date = date.Format(dateForm)
-			filter.SearchTerm = ""
-			tasks, err := s.repo.FindTask(ctx, filter)
-			if err != nil {
-				return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
-			}
-			return tasks, nil
-		}
+	}
 
-		tasks, err := s.repo.FindTask(ctx, filter)
-		if err != nil {
-			return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
-		}
-		return tasks, nil
-	default:
-		filter.Limit = limitSearch
-		res, err := s.repo.FindTask(ctx, filter)
-		if err != nil {
-			return []*domain.Task{}, domain.NewCustomError(0, domain.ErrInternalServer, err)
-		}
-		return res, nil
+	page, cErr := s.FindPage(ctx, filter)
+	if cErr != nil {
+		return []*domain.Task{}, cErr
 	}
+	return page.Tasks, nil
 }
 
-func (s *TaskService) Create(ctx context.Context, task *domain.Task) (int64, *domain.CustomError) {
-	now := time.Now()
-	nowF := now.Format(dateForm)
-
-	//Проверки и исправления запроса
-	if task.Title == "" {
-		return 0, domain.NewCustomError(0, domain.ErrBadTitle, nil)
-	}
-	if task.Date == "" {
-		task.Date = time.Now().Format(dateForm) //если дата пустая, присваиваем текущую
-	}
-	date, err := time.Parse(dateForm, task.Date)
-	if err != nil {
-		return 0, domain.NewCustomError(0, domain.ErrDate, err)
+// FindPage возвращает одну страницу списка задач и курсор следующей страницы
+func (s *TaskService) FindPage(ctx context.Context, filter *domain.Filter) (*domain.TaskPage, *domain.CustomError) {
+	switch {
+	case filter.Limit < 0:
+		return nil, domain.NewCustomError(0, domain.ErrLimit, nil)
+	case filter.Limit == 0:
+		filter.Limit = s.pageSize
+	case filter.Limit > s.maxPageSize:
+		filter.Limit = s.maxPageSize
 	}
-	if task.Repeat == "" && nowF > date.Format(dateForm) {
-		task.Date = nowF
+	if cErr := s.prepareFilter(ctx, filter); cErr != nil {
+		return nil, cErr
 	}
-	if nowF > task.Date {
-		task.Date, err = s.NextDate(now, task.Date, task.Repeat)
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor)
+		if err == nil && after.Sort != filter.Sort {
+			err = domain.NewMessage("cursor_sort", "курсор получен для другой сортировки")
+		}
 		if err != nil {
-			return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+			return nil, domain.NewCustomError(0, domain.ErrCursor, err)
 		}
+		filter.After = after
 	}
 
-	//Создаем задачу в БД
-	id, err := s.repo.CreateTask(ctx, task)
+	//Запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	limit := filter.Limit
+	filter.Limit = limit + 1
+	tasks, err := s.repo.FindTask(ctx, filter)
+	filter.Limit = limit
 	if err != nil {
-		return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
 	}
-	return id, nil
-}
 
-func (s *TaskService) Update(ctx context.Context, task *domain.Task) *domain.CustomError {
-	now := time.Now()
-	nowF := now.Format(dateForm)
-	//Проверки и исправления запроса
-	if task.Title == "" {
-		return domain.NewCustomError(0, domain.ErrBadTitle, nil)
+	page := &domain.TaskPage{Tasks: tasks}
+	if len(tasks) > limit {
+		page.Tasks = tasks[:limit]
+		page.NextCursor, err = encodeCursor(page.Tasks[limit-1], filter.Sort)
+		if err != nil {
+			return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+		}
 	}
-	if task.Date == "" {
-		task.Date = time.Now().Format(dateForm)
+	return page, nil
+}
+
+// Count возвращает число задач по каждому фильтру, например для бейджей
+// сохраненных фильтров. Хранилище считает все фильтры одним запросом.
+func (s *TaskService) Count(ctx context.Context, filters []*domain.Filter) ([]int, *domain.CustomError) {
+	for _, filter := range filters {
+		if cErr := s.prepareFilter(ctx, filter); cErr != nil {
+			return nil, cErr
+		}
 	}
-	date, err := time.Parse(dateForm, task.Date)
+	counts, err := s.repo.CountTasks(ctx, filters)
 	if err != nil {
-		return domain.NewCustomError(0, domain.ErrDate, err)
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
 	}
-	if task.Repeat == "" && nowF > date.Format(dateForm) {
-		task.Date = nowF
+	return counts, nil
+}
+
+// prepareFilter проверяет сортировку, вычисляет границы дат и разбирает строку поиска
+func (s *TaskService) prepareFilter(ctx context.Context, filter *domain.Filter) *domain.CustomError {
+	if !filter.Sort.Valid() {
+		return domain.NewCustomError(0, domain.ErrSort,
+			domain.NewMessage("sort_options", "%q, доступны: date, -date, title, -title", filter.Sort))
 	}
-	if nowF > task.Date {
-		task.Date, err = s.NextDate(now, task.Date, task.Repeat)
-		if err != nil {
-			return domain.NewCustomError(0, domain.ErrInternalServer, err)
-		}
+	now := s.Now(ctx)
+	if cErr := resolveDates(filter, now); cErr != nil {
+		return cErr
 	}
-	err = s.repo.UpdateTask(ctx, task)
-	if err != nil {
-		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	if filter.SearchTerm != "" {
+		if cErr := s.parseSearch(filter, now); cErr != nil {
+			return cErr
+		}
+		filter.SearchTerm = ""
 	}
 	return nil
 }
 
-func (s *TaskService) Done(ctx context.Context, filter *domain.Filter) *domain.CustomError {
-	now := time.Now()
-	task, err := s.repo.FindTask(ctx, filter)
-	if err != nil {
-		return domain.NewCustomError(0, domain.ErrID, err)
-	}
-	if len(task) == 0 {
-		return domain.NewCustomError(0, domain.ErrID, nil)
-	}
-	rDay, err := s.NextDate(now, task[0].Date, task[0].Repeat)
-	if err != nil {
-		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+// parseSearch разбирает строку поиска: дата 02.01.2006, диапазон дат или
+// запрос на языке поиска. Слова вроде "today" или "week" ищутся как текст,
+// период в строке поиска задается условием due:, например due:today или due:7d.
+func (s *TaskService) parseSearch(filter *domain.Filter, now time.Time) *domain.CustomError {
+	term := filter.SearchTerm
+	if date, err := time.Parse("02.01.2006", term); err == nil {
+		filter.Date = date.Format(dateForm)
+		return nil
 	}
-	if rDay == "delete" {
-		err = s.repo.DeleteTask(ctx, filter.ID)
-		if err != nil {
-			return domain.NewCustomError(0, domain.ErrInternalServer, err)
-		}
+	if from, to, ok := parseDateRange(term); ok {
+		narrowDates(filter, from, to)
 		return nil
 	}
-	task[0].ID = strconv.Itoa(*filter.ID)
-	task[0].Date = rDay
-	err = s.repo.UpdateTask(ctx, task[0])
+	query, err := ParseQuery(term, now)
 	if err != nil {
-		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+		return domain.NewCustomError(0, domain.ErrQuery, err)
 	}
+	filter.Query = query
 	return nil
 }
 
-func (s *TaskService) Delete(ctx context.Context, id int) *domain.CustomError {
-	err := s.repo.DeleteTask(ctx, &id)
+func (s *TaskService) Create(ctx context.Context, task *domain.Task) (int64, *domain.CustomError) {
+	if cErr := s.prepareTask(ctx, task); cErr != nil {
+		return 0, cErr
+	}
+
+	//Создаем задачу в БД
+	id, err := s.repo.CreateTask(ctx, task)
 	if err != nil {
-		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+		return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
 	}
-	return nil
+	s.metrics.TaskCreated()
+	return id, nil
 }
 
-func (s *TaskService) NextDate(now time.Time, dstart string, repeat string) (string, error) {
-	var res time.Time
-	pDate, err := time.Parse(dateForm, dstart)
+// Update заменяет задачу целиком. Строка блокируется на время записи,
+// ненулевая task.Version должна совпадать с текущей версией.
+func (s *TaskService) Update(ctx context.Context, task *domain.Task) *domain.CustomError {
+	if cErr := s.prepareTask(ctx, task); cErr != nil {
+		return cErr
+	}
+	id, err := strconv.Atoi(task.ID)
 	if err != nil {
-		return "", errors.New("неправильный формат даты")
+		return domain.NewCustomError(0, domain.ErrID, err)
 	}
-	switch {
-	case repeat == "":
-		return "delete", nil
-	case strings.HasPrefix(repeat, "d "):
-		daysStr := strings.TrimPrefix(repeat, "d ")
-		days, err := strconv.Atoi(daysStr)
-		if err != nil || days <= 0 || days > 400 {
-			return "", errors.New("не более 400 дней")
+	return s.inTx(ctx, func(tx *TaskService) *domain.CustomError {
+		if _, cErr := tx.lockTask(ctx, id, task.Version); cErr != nil {
+			return cErr
 		}
-		if now.After(pDate) {
-			diff := now.Sub(pDate)
-			totalDays := int(diff.Hours() / 24)
-			steps := totalDays/days + 1
-			res = pDate.AddDate(0, 0, steps*days)
-			return res.Format(dateForm), nil
-		} else {
-			pDate = pDate.AddDate(0, 0, days)
-			return pDate.Format(dateForm), nil
+		if err := tx.repo.UpdateTask(ctx, task); err != nil {
+			return storageError(err)
 		}
-	case repeat == "y":
-		if pDate.After(now) {
-			pDate = pDate.AddDate(1, 0, 0)
-			return pDate.Format(dateForm), nil
-		} else {
-			yearsDiff := now.Year() - pDate.Year()
-			pDate = pDate.AddDate(yearsDiff, 0, 0)
-			if !pDate.After(now) {
-				pDate = pDate.AddDate(1, 0, 0)
-			}
-			return pDate.Format(dateForm), nil
+		return nil
+	})
+}
+
+// Patch загружает задачу, применяет только переданные поля и сохраняет
+// ее с теми же проверками даты и правила повторения, что и Update.
+// Ненулевая version должна совпадать с текущей версией задачи.
+func (s *TaskService) Patch(ctx context.Context, id int, input *domain.TaskInput, version int64) (*domain.Task, *domain.CustomError) {
+	if cErr := validateInput(input); cErr != nil {
+		if repeatFailed(cErr) {
+			s.metrics.RepeatRuleError()
 		}
-	case strings.HasPrefix(repeat, "w "):
-		daysStr := strings.TrimPrefix(repeat, "w ")
-		dayNumbers := strings.Split(daysStr, ",")
-		var targetDays []int
-		for _, day := range dayNumbers {
-			dayNum, err := strconv.Atoi(day)
-			if err != nil || dayNum < 1 || dayNum > 7 {
-				return "", errors.New("неверный формат дней недели")
-			}
-			targetDays = append(targetDays, dayNum)
+		return nil, cErr
+	}
+	var task *domain.Task
+	cErr := s.inTx(ctx, func(tx *TaskService) *domain.CustomError {
+		current, cErr := tx.lockTask(ctx, id, version)
+		if cErr != nil {
+			return cErr
 		}
-		//Ищем ближайший день недели
-		res, err = findNextWeekday(now, targetDays)
-		if err != nil {
-			return "", err
+		for _, opt := range input.TaskToOptions() {
+			opt(current)
 		}
-		return res.Format(dateForm), nil
-	case strings.HasPrefix(repeat, "m "):
-		repeat = strings.TrimPrefix(repeat, "m ")
-		parts := strings.Split(repeat, " ")
-		if len(parts) == 0 || len(parts) > 2 {
-			return "", errors.New("неверный формат правила повторения")
+		current.ID = strconv.Itoa(id)
+		if cErr = tx.prepareTask(ctx, current); cErr != nil {
+			return cErr
 		}
-
-		// Дни
-		dayStrs := strings.Split(parts[0], ",")
-		var targetDays []int
-		for _, dayStr := range dayStrs {
-			day, err := strconv.Atoi(dayStr)
-			if err != nil || (day < -2 || day == 0 || day > 31) {
-				return "", errors.New("неверный формат дней месяца")
-			}
-			targetDays = append(targetDays, day)
+		if err := tx.repo.UpdateTask(ctx, current); err != nil {
+			return storageError(err)
 		}
+		task = current
+		return nil
+	})
+	if cErr != nil {
+		return nil, cErr
+	}
+	return task, nil
+}
 
-		// Месяцы
-		var targetMonths []int
-		if len(parts) == 2 {
-			monthStrs := strings.Split(parts[1], ",")
-			for _, monthStr := range monthStrs {
-				month, err := strconv.Atoi(monthStr)
-				if err != nil || month < 1 || month > 12 {
-					return "", errors.New("неверный формат месяцев")
-				}
-				targetMonths = append(targetMonths, month)
-			}
+// prepareTask проверяет задачу и переносит прошедшую дату:
+// разовую задачу - на сегодня, повторяющуюся - на следующую дату по правилу
+func (s *TaskService) prepareTask(ctx context.Context, task *domain.Task) *domain.CustomError {
+	rule, cErr := validateTask(task)
+	if cErr != nil {
+		if repeatFailed(cErr) {
+			s.metrics.RepeatRuleError()
 		}
+		return cErr
+	}
+	now := s.Now(ctx)
+	nowF := now.Format(dateForm)
 
-		res, err = findNextMonthDay(pDate, targetDays, targetMonths, now)
+	task.Tags = normalizeTags(task.Tags)
+	if task.Date == "" {
+		task.Date = nowF //если дата пустая, присваиваем текущую
+	}
+	if rule == nil && nowF > task.Date {
+		task.Date = nowF
+	}
+	if nowF > task.Date {
+		date, _ := time.Parse(dateForm, task.Date)
+		next, err := rule.Next(date, now)
 		if err != nil {
-			return "", err
+			s.metrics.RepeatRuleError()
+			return domain.NewCustomError(0, domain.ErrRepeat, err)
 		}
-		return res.Format(dateForm), nil
-	default:
-		return "", errors.New("неверный формат правила повторения")
+		task.Date = next.Format(dateForm)
 	}
+	return nil
 }
 
-func findNextWeekday(now time.Time, targetDays []int) (time.Time, error) {
-	currentDay := int(now.Weekday())
-	if currentDay == 0 {
-		currentDay = 7 // Преобразуем Sunday в 7 для удобства
-	}
-	//Поскольку в таком варианте, подходящий день может выпасть на сегодняшнее число,
-	//то проверяем сразу и следующую неделю
-	for i := 0; i < 14; i++ {
-		nextDay := (currentDay + i) % 7
-		if nextDay == 0 {
-			nextDay = 7 // Преобразуем Sunday обратно в 7
-		}
-		for _, targetDay := range targetDays {
-			if nextDay == targetDay {
-				candidate := now.AddDate(0, 0, i)
-				if candidate.After(now) {
-					return candidate, nil
-				}
-			}
+// normalizeTags нормализует проверенные теги и удаляет повторы
+func normalizeTags(tags []string) []string {
+	res := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if !slices.Contains(res, tag) {
+			res = append(res, tag)
 		}
 	}
-
-	return time.Time{}, errors.New("не удалось найти подходящий день недели")
+	return res
 }
 
-func findNextMonthDay(dstart time.Time, targetDays []int, targetMonths []int, now time.Time) (time.Time, error) {
-	currentYear, _, _ := dstart.Date()
-	var variants []time.Time
-
-	// Проверяем текущий и следующий год
-	for yearOffset := 0; yearOffset < 2; yearOffset++ {
-		for month := 1; month <= 12; month++ {
-			if len(targetMonths) > 0 && !contains(targetMonths, month) {
-				continue
-			}
-
-			lastDay := time.Date(currentYear+yearOffset, time.Month(month+1), 0, 0, 0, 0, 0, time.UTC).Day()
-
-			for _, day := range targetDays {
-				targetDay := day
-				if day == -1 {
-					targetDay = lastDay
-				} else if day == -2 {
-					targetDay = lastDay - 1
-				}
-				if targetDay < 1 || targetDay > lastDay {
-					continue
-				}
-				date := time.Date(currentYear+yearOffset, time.Month(month), targetDay, 0, 0, 0, 0, time.UTC)
-				if !date.Before(dstart) && date.After(now) {
-					variants = append(variants, date)
-				}
+// Done отмечает задачу выполненной. Для повторяющейся задачи возвращает ее
+// с новой датой, разовая задача удаляется и возвращается nil. Задача
+// блокируется на время операции, поэтому параллельные Done выполняются
+// по очереди и каждый сдвигает дату от результата предыдущего.
+func (s *TaskService) Done(ctx context.Context, filter *domain.Filter, version int64) (*domain.Task, *domain.CustomError) {
+	if filter.ID == nil {
+		return nil, domain.NewCustomError(0, domain.ErrID, nil)
+	}
+	id := *filter.ID
+	var done *domain.Task
+	cErr := s.inTx(ctx, func(tx *TaskService) *domain.CustomError {
+		task, cErr := tx.lockTask(ctx, id, version)
+		if cErr != nil {
+			return cErr
+		}
+		rDay, err := tx.NextDate(tx.Now(ctx), task.Date, task.Repeat)
+		if err != nil {
+			tx.metrics.RepeatRuleError()
+			return domain.NewCustomError(0, domain.ErrRepeat, err)
+		}
+		if rDay == "delete" {
+			if err = tx.repo.DeleteTask(ctx, &id, task.Version); err != nil {
+				return storageError(err)
 			}
+			return nil
+		}
+		task.ID = strconv.Itoa(id)
+		task.Date = rDay
+		if err = tx.repo.UpdateTask(ctx, task); err != nil {
+			return storageError(err)
 		}
+		done = task
+		return nil
+	})
+	if cErr != nil {
+		return nil, cErr
 	}
-	if len(variants) == 0 {
-		return time.Time{}, errors.New("не удалось найти подходящую дату")
+	s.metrics.TaskCompleted()
+	return done, nil
+}
+
+func (s *TaskService) Delete(ctx context.Context, id int, version int64) *domain.CustomError {
+	err := s.repo.DeleteTask(ctx, &id, version)
+	if err != nil {
+		return storageError(err)
 	}
+	s.metrics.TaskDeleted()
+	return nil
+}
 
-	//Находим минимальную дату
-	minDate := variants[0]
-	for _, date := range variants {
-		if date.Before(minDate) {
-			minDate = date
-		}
+// storageError отделяет отсутствие записи от прочих ошибок хранилища
+// storageError переводит ошибку хранилища в ответ. Текст хранилища клиенту
+// не нужен: известную ошибку полностью описывает ее код.
+func storageError(err error) *domain.CustomError {
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.NewCustomError(0, domain.ErrNotFound, nil)
+	}
+	if errors.Is(err, domain.ErrVersion) {
+		return domain.NewCustomError(0, domain.ErrVersion, nil)
 	}
-	return minDate, nil
+	return domain.NewCustomError(0, domain.ErrInternalServer, err)
 }
 
-func contains(arr []int, val int) bool {
-	for _, v := range arr {
-		if v == val {
-			return true
-		}
+func (s *TaskService) NextDate(now time.Time, dstart string, repeat string) (string, error) {
+	pDate, err := time.Parse(dateForm, dstart)
+	if err != nil {
+		return "", domain.ErrDate
+	}
+	rule, err := domain.ParseRepeat(repeat)
+	if err != nil {
+		return "", err
+	}
+	if rule == nil {
+		return "delete", nil
+	}
+	res, err := rule.Next(pDate, now)
+	if err != nil {
+		return "", err
 	}
-	return false
+	return res.Format(dateForm), nil
 }
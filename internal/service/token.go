@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// TokenPrefix отличает персональные API-токены от JWT в заголовке Authorization
+const TokenPrefix string = "todo_"
+
+const tokenBytes int = 32
+
+type TokenService struct {
+	repo domain.TokenRepository
+}
+
+func NewTokenService(repo domain.TokenRepository) *TokenService {
+	return &TokenService{repo: repo}
+}
+
+func IsAPIToken(raw string) bool {
+	return strings.HasPrefix(raw, TokenPrefix)
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create выпускает новый токен. Открытое значение возвращается только здесь,
+// в БД сохраняется sha256 от него.
+func (s *TokenService) Create(ctx context.Context, name string, scopes []domain.Scope, ttl time.Duration) (string, *domain.APIToken, *domain.CustomError) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, domain.NewCustomError(0, domain.ErrTokenName, nil)
+	}
+	if len(scopes) == 0 {
+		scopes = []domain.Scope{domain.ScopeRead}
+	}
+	for _, scope := range scopes {
+		if scope != domain.ScopeRead && scope != domain.ScopeWrite {
+			return "", nil, domain.NewCustomError(0, domain.ErrTokenScope, fmt.Errorf("%q", scope))
+		}
+	}
+
+	buf := make([]byte, tokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	raw := TokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now().UTC()
+	token := &domain.APIToken{
+		Name:      name,
+		Prefix:    raw[:len(TokenPrefix)+6],
+		Hash:      hashToken(raw),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		token.ExpiresAt = &expires
+	}
+
+	id, err := s.repo.CreateToken(ctx, token)
+	if err != nil {
+		return "", nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	token.ID = id
+	return raw, token, nil
+}
+
+func (s *TokenService) List(ctx context.Context) ([]*domain.APIToken, *domain.CustomError) {
+	tokens, err := s.repo.ListTokens(ctx)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return tokens, nil
+}
+
+func (s *TokenService) Revoke(ctx context.Context, id int64) *domain.CustomError {
+	if err := s.repo.RevokeToken(ctx, id); err != nil {
+		if errors.Is(err, domain.ErrTokenNotFound) {
+			return domain.NewCustomError(0, domain.ErrTokenNotFound, nil)
+		}
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return nil
+}
+
+// Authenticate проверяет открытое значение токена и возвращает его запись
+func (s *TokenService) Authenticate(ctx context.Context, raw string) (*domain.APIToken, *domain.CustomError) {
+	if !IsAPIToken(raw) {
+		return nil, domain.NewCustomError(0, domain.ErrToken, nil)
+	}
+	token, err := s.repo.FindTokenByHash(ctx, hashToken(raw))
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	now := time.Now().UTC()
+	if token == nil || !token.Active(now) {
+		return nil, domain.NewCustomError(0, domain.ErrToken, nil)
+	}
+	// Время последнего использования - информационное, ошибку не пробрасываем
+	_ = s.repo.TouchToken(ctx, token.ID, now)
+	return token, nil
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// tokenRepo - хранилище токенов в памяти для тестов
+type tokenRepo struct {
+	tokens map[int64]*domain.APIToken
+	nextID int64
+}
+
+func newTokenRepo() *tokenRepo {
+	return &tokenRepo{tokens: make(map[int64]*domain.APIToken), nextID: 1}
+}
+
+func (r *tokenRepo) CreateToken(_ context.Context, token *domain.APIToken) (int64, error) {
+	id := r.nextID
+	r.nextID++
+	stored := *token
+	stored.ID = id
+	r.tokens[id] = &stored
+	return id, nil
+}
+
+func (r *tokenRepo) FindTokenByHash(_ context.Context, hash string) (*domain.APIToken, error) {
+	for _, token := range r.tokens {
+		if token.Hash == hash {
+			found := *token
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *tokenRepo) ListTokens(_ context.Context) ([]*domain.APIToken, error) {
+	tokens := make([]*domain.APIToken, 0, len(r.tokens))
+	for _, token := range r.tokens {
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func (r *tokenRepo) RevokeToken(_ context.Context, id int64) error {
+	token, ok := r.tokens[id]
+	if !ok {
+		return domain.ErrTokenNotFound
+	}
+	now := time.Now().UTC()
+	token.RevokedAt = &now
+	return nil
+}
+
+func (r *tokenRepo) TouchToken(_ context.Context, id int64, usedAt time.Time) error {
+	if token, ok := r.tokens[id]; ok {
+		token.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func TestTokenCreateStoresOnlyHash(t *testing.T) {
+	repo := newTokenRepo()
+	s := NewTokenService(repo)
+	ctx := context.Background()
+
+	raw, token, cErr := s.Create(ctx, " ci ", nil, 0)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if !IsAPIToken(raw) || !strings.HasPrefix(raw, TokenPrefix) {
+		t.Fatalf("токен %q без префикса %q", raw, TokenPrefix)
+	}
+	stored := repo.tokens[token.ID]
+	sum := sha256.Sum256([]byte(raw))
+	if stored.Hash != hex.EncodeToString(sum[:]) {
+		t.Errorf("в хранилище %q, ожидался sha256 открытого значения", stored.Hash)
+	}
+	if strings.Contains(stored.Hash, raw) || stored.Prefix == raw {
+		t.Error("открытое значение токена попало в хранилище")
+	}
+	if stored.Prefix != raw[:len(TokenPrefix)+6] {
+		t.Errorf("Prefix = %q", stored.Prefix)
+	}
+	if stored.Name != "ci" {
+		t.Errorf("Name = %q, ожидалось имя без пробелов", stored.Name)
+	}
+	if len(stored.Scopes) != 1 || stored.Scopes[0] != domain.ScopeRead {
+		t.Errorf("Scopes = %v, по умолчанию ожидалось только read", stored.Scopes)
+	}
+
+	other, _, cErr := s.Create(ctx, "ci", nil, 0)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if other == raw {
+		t.Error("два токена получили одно значение")
+	}
+}
+
+func TestTokenCreateValidation(t *testing.T) {
+	s := NewTokenService(newTokenRepo())
+	tests := []struct {
+		name   string
+		scopes []domain.Scope
+		want   *domain.Error
+	}{
+		{"", nil, domain.ErrTokenName},
+		{"  ", nil, domain.ErrTokenName},
+		{"ci", []domain.Scope{"admin"}, domain.ErrTokenScope},
+		{"ci", []domain.Scope{domain.ScopeRead, "READ"}, domain.ErrTokenScope},
+	}
+	for _, tt := range tests {
+		_, _, cErr := s.Create(context.Background(), tt.name, tt.scopes, 0)
+		if cErr == nil || cErr.Err != tt.want {
+			t.Errorf("Create(%q, %v) = %v, ожидалось %v", tt.name, tt.scopes, cErr, tt.want)
+		}
+	}
+}
+
+func TestTokenAuthenticate(t *testing.T) {
+	repo := newTokenRepo()
+	s := NewTokenService(repo)
+	ctx := context.Background()
+
+	raw, token, cErr := s.Create(ctx, "ci", []domain.Scope{domain.ScopeWrite}, time.Hour)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	got, cErr := s.Authenticate(ctx, raw)
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if got.ID != token.ID {
+		t.Errorf("найден токен %d, ожидался %d", got.ID, token.ID)
+	}
+	if repo.tokens[token.ID].LastUsedAt == nil {
+		t.Error("не записано время последнего использования")
+	}
+
+	for _, bad := range []string{"", raw[len(TokenPrefix):], raw + "x", TokenPrefix, strings.ToUpper(raw)} {
+		if _, cErr := s.Authenticate(ctx, bad); cErr == nil || cErr.Err != domain.ErrToken {
+			t.Errorf("Authenticate(%q) = %v, ожидалось %v", bad, cErr, domain.ErrToken)
+		}
+	}
+
+	expired := time.Now().UTC().Add(-time.Minute)
+	repo.tokens[token.ID].ExpiresAt = &expired
+	if _, cErr := s.Authenticate(ctx, raw); cErr == nil || cErr.Err != domain.ErrToken {
+		t.Errorf("истекший токен: %v, ожидалось %v", cErr, domain.ErrToken)
+	}
+
+	raw, token, _ = s.Create(ctx, "ci", nil, 0)
+	if cErr := s.Revoke(ctx, token.ID); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if _, cErr := s.Authenticate(ctx, raw); cErr == nil || cErr.Err != domain.ErrToken {
+		t.Errorf("отозванный токен: %v, ожидалось %v", cErr, domain.ErrToken)
+	}
+	if cErr := s.Revoke(ctx, 999); cErr == nil || cErr.Err != domain.ErrTokenNotFound {
+		t.Errorf("Revoke неизвестного id = %v, ожидалось %v", cErr, domain.ErrTokenNotFound)
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Параметры TOTP по RFC 6238, совместимые с Google Authenticator и аналогами
+const (
+	totpPeriod        int64 = 30
+	totpDigits        int   = 6
+	totpSkew          int64 = 1 // допускаем расхождение часов на один шаг
+	totpSecretBytes   int   = 20
+	recoveryCodeCount int   = 10
+	recoveryCodeBytes int   = 5
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type TwoFactorService struct {
+	repo   domain.TwoFactorRepository
+	issuer string
+	now    func() time.Time
+}
+
+type TwoFactorOption func(*TwoFactorService)
+
+func NewTwoFactorService(repo domain.TwoFactorRepository, issuer string, opts ...TwoFactorOption) *TwoFactorService {
+	s := &TwoFactorService{repo: repo, issuer: issuer, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithTOTPClock подменяет источник времени, например фиксированными часами в тестах
+func WithTOTPClock(now func() time.Time) TwoFactorOption {
+	return func(s *TwoFactorService) {
+		s.now = now
+	}
+}
+
+// Enroll создает новый секрет и коды восстановления. 2FA включается только
+// после Confirm, поэтому повторный Enroll до подтверждения просто заменяет секрет.
+func (s *TwoFactorService) Enroll(ctx context.Context, account string) (*domain.Enrollment, *domain.CustomError) {
+	current, err := s.repo.GetTwoFactor(ctx, account)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	if current != nil && current.Enabled {
+		return nil, domain.NewCustomError(0, domain.ErrOTPEnrolled, nil)
+	}
+
+	secret := make([]byte, totpSecretBytes)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+
+	tf := &domain.TwoFactor{
+		Account:       account,
+		Secret:        b32.EncodeToString(secret),
+		RecoveryCodes: hashes,
+		CreatedAt:     s.now().UTC(),
+	}
+	if err = s.repo.SaveTwoFactor(ctx, tf); err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return &domain.Enrollment{
+		Secret:        tf.Secret,
+		URI:           s.otpauthURI(account, tf.Secret),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// Confirm включает 2FA после ввода первого кода из приложения
+func (s *TwoFactorService) Confirm(ctx context.Context, account, code string) *domain.CustomError {
+	tf, cErr := s.load(ctx, account)
+	if cErr != nil {
+		return cErr
+	}
+	if tf.Enabled {
+		return domain.NewCustomError(0, domain.ErrOTPEnrolled, nil)
+	}
+	step, cErr := s.acceptCode(ctx, tf, code)
+	if cErr != nil {
+		return cErr
+	}
+	tf.Enabled = true
+	tf.LastStep = step
+	if err := s.repo.SaveTwoFactor(ctx, tf); err != nil {
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return nil
+}
+
+// Disable отключает 2FA, требуя действующий код
+func (s *TwoFactorService) Disable(ctx context.Context, account, code string) *domain.CustomError {
+	if cErr := s.Verify(ctx, account, code); cErr != nil {
+		return cErr
+	}
+	if err := s.repo.DeleteTwoFactor(ctx, account); err != nil {
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return nil
+}
+
+func (s *TwoFactorService) Enabled(ctx context.Context, account string) (bool, *domain.CustomError) {
+	tf, err := s.repo.GetTwoFactor(ctx, account)
+	if err != nil {
+		return false, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return tf != nil && tf.Enabled, nil
+}
+
+// Verify проверяет код TOTP при входе
+func (s *TwoFactorService) Verify(ctx context.Context, account, code string) *domain.CustomError {
+	tf, cErr := s.load(ctx, account)
+	if cErr != nil {
+		return cErr
+	}
+	if !tf.Enabled {
+		return domain.NewCustomError(0, domain.ErrOTPNotEnrolled, nil)
+	}
+	_, cErr = s.acceptCode(ctx, tf, code)
+	return cErr
+}
+
+// Redeem погашает одноразовый код восстановления вместо TOTP
+func (s *TwoFactorService) Redeem(ctx context.Context, account, recoveryCode string) *domain.CustomError {
+	tf, cErr := s.load(ctx, account)
+	if cErr != nil {
+		return cErr
+	}
+	if !tf.Enabled {
+		return domain.NewCustomError(0, domain.ErrOTPNotEnrolled, nil)
+	}
+	// Хранилище удаляет код условно: из двух одновременных запросов
+	// с одним кодом его погасит только один
+	used, err := s.repo.UseRecoveryCode(ctx, account, hashRecoveryCode(recoveryCode))
+	if err != nil {
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	if !used {
+		return domain.NewCustomError(0, domain.ErrOTPCode, nil)
+	}
+	return nil
+}
+
+func (s *TwoFactorService) load(ctx context.Context, account string) (*domain.TwoFactor, *domain.CustomError) {
+	tf, err := s.repo.GetTwoFactor(ctx, account)
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	if tf == nil {
+		return nil, domain.NewCustomError(0, domain.ErrOTPNotEnrolled, nil)
+	}
+	return tf, nil
+}
+
+// acceptCode сверяет код с соседними шагами и условно запоминает принятый
+// шаг в хранилище, чтобы тот же код нельзя было использовать повторно
+// даже параллельным запросом
+func (s *TwoFactorService) acceptCode(ctx context.Context, tf *domain.TwoFactor, code string) (int64, *domain.CustomError) {
+	secret, err := b32.DecodeString(tf.Secret)
+	if err != nil {
+		return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	step := s.now().Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		candidate := step + i
+		if candidate <= tf.LastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, candidate)), []byte(code)) != 1 {
+			continue
+		}
+		advanced, err := s.repo.AdvanceTOTPStep(ctx, tf.Account, candidate)
+		if err != nil {
+			return 0, domain.NewCustomError(0, domain.ErrInternalServer, err)
+		}
+		if !advanced {
+			break
+		}
+		return candidate, nil
+	}
+	return 0, domain.NewCustomError(0, domain.ErrOTPCode, nil)
+}
+
+func (s *TwoFactorService) otpauthURI(account, secret string) string {
+	label := url.PathEscape(s.issuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", s.issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// totpCode - HOTP (RFC 4226) от номера шага времени
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(b32.EncodeToString(buf))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
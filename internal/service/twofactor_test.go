@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// newTwoFactorRepo - хранилище 2FA в памяти с уже сохраненной записью
+func newTwoFactorRepo(t *testing.T, tf domain.TwoFactor) *memory.TwoFactorStore {
+	t.Helper()
+	repo := memory.NewTwoFactorStore()
+	if err := repo.SaveTwoFactor(context.Background(), &tf); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// fixedClock - часы, которые тест переводит вручную
+type fixedClock struct {
+	t time.Time
+}
+
+func (c *fixedClock) now() time.Time {
+	return c.t
+}
+
+// rfcSecret - общий секрет тестовых векторов SHA1 из приложения B RFC 6238
+const rfcSecret = "12345678901234567890"
+
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	// RFC дает 8 цифр; у нас 6, это последние 6 цифр того же значения
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode([]byte(rfcSecret), tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode(T=%d) = %s, ожидалось %s", tt.unix, got, tt.want)
+		}
+
+		repo := newTwoFactorRepo(t, domain.TwoFactor{Account: "admin", Secret: b32.EncodeToString([]byte(rfcSecret)), Enabled: true})
+		clock := &fixedClock{t: time.Unix(tt.unix, 0)}
+		s := NewTwoFactorService(repo, "TODO", WithTOTPClock(clock.now))
+		if cErr := s.Verify(context.Background(), "admin", tt.want); cErr != nil {
+			t.Errorf("Verify(T=%d, %s): %v", tt.unix, tt.want, cErr)
+		}
+	}
+}
+
+func TestTwoFactorEnrollAndConfirm(t *testing.T) {
+	repo := memory.NewTwoFactorStore()
+	clock := &fixedClock{t: time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)}
+	s := NewTwoFactorService(repo, "TODO app", WithTOTPClock(clock.now))
+	ctx := context.Background()
+
+	enrollment, cErr := s.Enroll(ctx, "admin")
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	if len(enrollment.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("кодов восстановления %d, ожидалось %d", len(enrollment.RecoveryCodes), recoveryCodeCount)
+	}
+	uri, err := url.Parse(enrollment.URI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Query().Get("secret") != enrollment.Secret || uri.Query().Get("issuer") != "TODO app" {
+		t.Errorf("URI = %s", enrollment.URI)
+	}
+	if enabled, _ := s.Enabled(ctx, "admin"); enabled {
+		t.Fatal("2FA включена до подтверждения")
+	}
+	if cErr := s.Verify(ctx, "admin", "000000"); cErr == nil || cErr.Err != domain.ErrOTPNotEnrolled {
+		t.Errorf("Verify до подтверждения = %v, ожидалось %v", cErr, domain.ErrOTPNotEnrolled)
+	}
+
+	secret, err := b32.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpCode(secret, clock.t.Unix()/totpPeriod)
+	wrong := totpCode(secret, clock.t.Unix()/totpPeriod+5)
+	if cErr := s.Confirm(ctx, "admin", wrong); cErr == nil || cErr.Err != domain.ErrOTPCode {
+		t.Errorf("Confirm с неверным кодом = %v, ожидалось %v", cErr, domain.ErrOTPCode)
+	}
+	if cErr := s.Confirm(ctx, "admin", code); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if enabled, _ := s.Enabled(ctx, "admin"); !enabled {
+		t.Fatal("2FA не включилась после подтверждения")
+	}
+	if _, cErr := s.Enroll(ctx, "admin"); cErr == nil || cErr.Err != domain.ErrOTPEnrolled {
+		t.Errorf("повторный Enroll = %v, ожидалось %v", cErr, domain.ErrOTPEnrolled)
+	}
+	// Код подтверждения уже использован и для входа не годится
+	if cErr := s.Verify(ctx, "admin", code); cErr == nil || cErr.Err != domain.ErrOTPCode {
+		t.Errorf("повтор кода подтверждения = %v, ожидалось %v", cErr, domain.ErrOTPCode)
+	}
+
+	clock.t = clock.t.Add(time.Duration(totpPeriod) * time.Second)
+	if cErr := s.Disable(ctx, "admin", totpCode(secret, clock.t.Unix()/totpPeriod)); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if enabled, _ := s.Enabled(ctx, "admin"); enabled {
+		t.Error("2FA осталась включенной после Disable")
+	}
+}
+
+func TestTOTPSkewWindow(t *testing.T) {
+	secret := []byte(rfcSecret)
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	step := now.Unix() / totpPeriod
+
+	tests := []struct {
+		offset int64
+		ok     bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, tt := range tests {
+		repo := newTwoFactorRepo(t, domain.TwoFactor{Account: "admin", Secret: b32.EncodeToString(secret), Enabled: true})
+		s := NewTwoFactorService(repo, "TODO", WithTOTPClock(func() time.Time { return now }))
+		cErr := s.Verify(context.Background(), "admin", totpCode(secret, step+tt.offset))
+		if (cErr == nil) != tt.ok {
+			t.Errorf("шаг %+d: %v, ожидалось принятие = %v", tt.offset, cErr, tt.ok)
+		}
+	}
+}
+
+func TestTOTPRejectsReplay(t *testing.T) {
+	secret := []byte(rfcSecret)
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	step := now.Unix() / totpPeriod
+	repo := newTwoFactorRepo(t, domain.TwoFactor{Account: "admin", Secret: b32.EncodeToString(secret), Enabled: true})
+	s := NewTwoFactorService(repo, "TODO", WithTOTPClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	if cErr := s.Verify(ctx, "admin", totpCode(secret, step+1)); cErr != nil {
+		t.Fatal(cErr)
+	}
+	// После принятого шага не годятся ни он сам, ни более ранние
+	for _, offset := range []int64{1, 0, -1} {
+		if cErr := s.Verify(ctx, "admin", totpCode(secret, step+offset)); cErr == nil {
+			t.Errorf("шаг %+d принят повторно", offset)
+		}
+	}
+}
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	repo := memory.NewTwoFactorStore()
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	s := NewTwoFactorService(repo, "TODO", WithTOTPClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	enrollment, cErr := s.Enroll(ctx, "admin")
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+	code := enrollment.RecoveryCodes[0]
+	if cErr := s.Redeem(ctx, "admin", code); cErr == nil || cErr.Err != domain.ErrOTPNotEnrolled {
+		t.Errorf("Redeem до подтверждения = %v, ожидалось %v", cErr, domain.ErrOTPNotEnrolled)
+	}
+	secret, _ := b32.DecodeString(enrollment.Secret)
+	if cErr := s.Confirm(ctx, "admin", totpCode(secret, now.Unix()/totpPeriod)); cErr != nil {
+		t.Fatal(cErr)
+	}
+
+	if cErr := s.Redeem(ctx, "admin", code); cErr != nil {
+		t.Fatal(cErr)
+	}
+	if cErr := s.Redeem(ctx, "admin", code); cErr == nil || cErr.Err != domain.ErrOTPCode {
+		t.Errorf("повторный Redeem = %v, ожидалось %v", cErr, domain.ErrOTPCode)
+	}
+	stored, err := repo.GetTwoFactor(ctx, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left := len(stored.RecoveryCodes); left != recoveryCodeCount-1 {
+		t.Errorf("осталось кодов %d, ожидалось %d", left, recoveryCodeCount-1)
+	}
+
+	// Регистр, дефис и пробелы вокруг кода не важны
+	loose := "  " + strings.ToUpper(strings.ReplaceAll(enrollment.RecoveryCodes[1], "-", "")) + " "
+	if cErr := s.Redeem(ctx, "admin", loose); cErr != nil {
+		t.Errorf("Redeem(%q): %v", loose, cErr)
+	}
+	if cErr := s.Redeem(ctx, "admin", "aaaa-aaaa"); cErr == nil || cErr.Err != domain.ErrOTPCode {
+		t.Errorf("Redeem неизвестного кода = %v, ожидалось %v", cErr, domain.ErrOTPCode)
+	}
+}
+
+// replayConcurrently запускает attempt из многих горутин одновременно
+// и возвращает число успешных попыток
+func replayConcurrently(attempt func() *domain.CustomError) int {
+	const workers = 32
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		ok    atomic.Int32
+	)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if attempt() == nil {
+				ok.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return int(ok.Load())
+}
+
+func TestTwoFactorConcurrentReplay(t *testing.T) {
+	secret := []byte(rfcSecret)
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	t.Run("totp", func(t *testing.T) {
+		repo := newTwoFactorRepo(t, domain.TwoFactor{Account: "admin", Secret: b32.EncodeToString(secret), Enabled: true})
+		s := NewTwoFactorService(repo, "TODO", WithTOTPClock(func() time.Time { return now }))
+		code := totpCode(secret, now.Unix()/totpPeriod)
+
+		if n := replayConcurrently(func() *domain.CustomError { return s.Verify(ctx, "admin", code) }); n != 1 {
+			t.Errorf("код принят %d раз, ожидалось 1", n)
+		}
+	})
+
+	t.Run("recovery", func(t *testing.T) {
+		code := "abcd-efgh"
+		repo := newTwoFactorRepo(t, domain.TwoFactor{
+			Account:       "admin",
+			Secret:        b32.EncodeToString(secret),
+			Enabled:       true,
+			RecoveryCodes: []string{hashRecoveryCode(code), hashRecoveryCode("ijkl-mnop")},
+		})
+		s := NewTwoFactorService(repo, "TODO", WithTOTPClock(func() time.Time { return now }))
+
+		if n := replayConcurrently(func() *domain.CustomError { return s.Redeem(ctx, "admin", code) }); n != 1 {
+			t.Errorf("код восстановления принят %d раз, ожидалось 1", n)
+		}
+		stored, err := repo.GetTwoFactor(ctx, "admin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored.RecoveryCodes) != 1 {
+			t.Errorf("осталось кодов %d, ожидалось 1", len(stored.RecoveryCodes))
+		}
+	})
+}
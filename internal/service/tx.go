@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+)
+
+// errRollback откатывает транзакцию или точку сохранения после ошибки операции
+var errRollback = errors.New("откат транзакции")
+
+// withRepo возвращает копию сервиса, работающую с другим хранилищем, например с транзакцией
+func (s *TaskService) withRepo(repo domain.TaskRepository) *TaskService {
+	tx := *s
+	tx.repo = repo
+	return &tx
+}
+
+// inTx выполняет fn в транзакции хранилища. Ошибка fn откатывает транзакцию
+// и возвращается как есть, ошибка фиксации становится внутренней ошибкой.
+func (s *TaskService) inTx(ctx context.Context, fn func(tx *TaskService) *domain.CustomError) *domain.CustomError {
+	var cErr *domain.CustomError
+	err := s.repo.WithTx(ctx, func(repo domain.TaskRepository) error {
+		if cErr = fn(s.withRepo(repo)); cErr != nil {
+			return errRollback
+		}
+		return nil
+	})
+	if cErr != nil {
+		return cErr
+	}
+	if err != nil {
+		logging.FromContext(ctx).Error("Transaction failed", "error", err)
+		return domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	return nil
+}
+
+// lockTask загружает задачу и блокирует ее до конца транзакции, чтобы
+// параллельный запрос не изменил ее между чтением и записью.
+// Ненулевая version должна совпадать с текущей версией задачи.
+func (s *TaskService) lockTask(ctx context.Context, id int, version int64) (*domain.Task, *domain.CustomError) {
+	tasks, err := s.repo.FindTask(ctx, &domain.Filter{ID: &id, ForUpdate: true})
+	if err != nil {
+		return nil, domain.NewCustomError(0, domain.ErrInternalServer, err)
+	}
+	if len(tasks) == 0 {
+		return nil, domain.NewCustomError(0, domain.ErrNotFound, nil)
+	}
+	if version != 0 && tasks[0].Version != version {
+		return nil, domain.NewCustomError(0, domain.ErrVersion, nil)
+	}
+	return tasks[0], nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Ограничения полей задачи; заголовок хранится в VARCHAR(255)
+const (
+	maxTitleLength   = 255
+	maxCommentLength = 10000
+)
+
+// taskValidator собирает все нарушения в задаче, а не только первое.
+// Правило повторения разбирается один раз и сохраняется в rule.
+type taskValidator struct {
+	fields []domain.FieldError
+	first  *domain.Error
+	rule   *domain.RepeatRule
+}
+
+func (v *taskValidator) fail(err *domain.Error, pointer string) {
+	if v.first == nil {
+		v.first = err
+	}
+	v.fields = append(v.fields, domain.FieldError{Pointer: pointer, Code: err.Code, Detail: err.Message})
+}
+
+func (v *taskValidator) title(title string) {
+	switch {
+	case title == "":
+		v.fail(domain.ErrBadTitle, "/title")
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		v.fail(domain.ErrTitleLength, "/title")
+	}
+}
+
+// date проверяет формат; пустая дата допустима и означает сегодня
+func (v *taskValidator) date(date string) {
+	if date == "" {
+		return
+	}
+	if _, err := time.Parse(dateForm, date); err != nil {
+		v.fail(domain.ErrDate, "/date")
+	}
+}
+
+func (v *taskValidator) comment(comment string) {
+	if utf8.RuneCountInString(comment) > maxCommentLength {
+		v.fail(domain.ErrCommentLength, "/comment")
+	}
+}
+
+func (v *taskValidator) repeat(repeat string) {
+	rule, err := domain.ParseRepeat(repeat)
+	var dErr *domain.Error
+	if errors.As(err, &dErr) {
+		v.fail(dErr, "/repeat")
+		return
+	}
+	v.rule = rule
+}
+
+func (v *taskValidator) priority(priority int) {
+	if priority < domain.PriorityNone || priority > domain.PriorityHigh {
+		v.fail(domain.ErrPriority, "/priority")
+	}
+}
+
+func (v *taskValidator) tags(tags []string) {
+	for i, tag := range tags {
+		if !queryTagValue.MatchString(normalizeTag(tag)) {
+			v.fail(domain.ErrTag, "/tags/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// err возвращает ошибку со всеми нарушениями или nil. Единственное нарушение
+// отдается своим кодом, несколько - общим ErrValidation.
+func (v *taskValidator) err() *domain.CustomError {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	var cErr *domain.CustomError
+	if len(v.fields) == 1 {
+		cErr = domain.NewCustomError(0, v.first, nil)
+	} else {
+		cErr = domain.NewCustomError(0, domain.ErrValidation, nil)
+	}
+	cErr.Fields = v.fields
+	return cErr
+}
+
+// validateTask проверяет все поля задачи и возвращает разобранное правило повторения
+func validateTask(task *domain.Task) (*domain.RepeatRule, *domain.CustomError) {
+	var v taskValidator
+	v.title(task.Title)
+	v.date(task.Date)
+	v.comment(task.Comment)
+	v.repeat(task.Repeat)
+	v.priority(task.Priority)
+	v.tags(task.Tags)
+	return v.rule, v.err()
+}
+
+// validateInput проверяет только поля, переданные в частичном обновлении
+func validateInput(input *domain.TaskInput) *domain.CustomError {
+	var v taskValidator
+	if input.Title != nil {
+		v.title(*input.Title)
+	}
+	if input.Date != nil {
+		v.date(*input.Date)
+	}
+	if input.Comment != nil {
+		v.comment(*input.Comment)
+	}
+	if input.Repeat != nil {
+		v.repeat(*input.Repeat)
+	}
+	if input.Priority != nil {
+		v.priority(*input.Priority)
+	}
+	if input.Tags != nil {
+		v.tags(*input.Tags)
+	}
+	return v.err()
+}
+
+// normalizeTag убирает # и приводит тег к нижнему регистру
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/agidelle/TODO_web_v2/internal/storage/memory"
+)
+
+// pointers возвращает JSON Pointer каждого нарушения
+func pointers(cErr *domain.CustomError) string {
+	if cErr == nil {
+		return ""
+	}
+	var res []string
+	for _, field := range cErr.Fields {
+		res = append(res, field.Pointer)
+	}
+	return strings.Join(res, " ")
+}
+
+func TestValidateTask(t *testing.T) {
+	valid := func(opts ...func(*domain.Task)) *domain.Task {
+		task := &domain.Task{Title: "Отчет", Date: "20240201", Repeat: "d 7", Tags: []string{"work", "#Ops"}, Priority: domain.PriorityHigh}
+		for _, opt := range opts {
+			opt(task)
+		}
+		return task
+	}
+	tests := []struct {
+		name     string
+		task     *domain.Task
+		err      *domain.Error
+		pointers string
+	}{
+		{"без нарушений", valid(), nil, ""},
+		{"пустая дата допустима", valid(func(t *domain.Task) { t.Date = "" }), nil, ""},
+		// Одно нарушение отдается своим кодом
+		{"пустой заголовок", valid(func(t *domain.Task) { t.Title = "" }), domain.ErrBadTitle, "/title"},
+		{"длинный заголовок", valid(func(t *domain.Task) { t.Title = strings.Repeat("я", maxTitleLength+1) }), domain.ErrTitleLength, "/title"},
+		{"заголовок на пределе", valid(func(t *domain.Task) { t.Title = strings.Repeat("я", maxTitleLength) }), nil, ""},
+		{"дата", valid(func(t *domain.Task) { t.Date = "01.02.2024" }), domain.ErrDate, "/date"},
+		{"комментарий", valid(func(t *domain.Task) { t.Comment = strings.Repeat("a", maxCommentLength+1) }), domain.ErrCommentLength, "/comment"},
+		{"приоритет", valid(func(t *domain.Task) { t.Priority = 4 }), domain.ErrPriority, "/priority"},
+		{"тег", valid(func(t *domain.Task) { t.Tags = []string{"ok", "два слова"} }), domain.ErrTag, "/tags/1"},
+		// Несколько нарушений - общий код и все указатели в порядке полей
+		{"два тега", valid(func(t *domain.Task) { t.Tags = []string{"a+b", "ok", "c d"} }), domain.ErrValidation, "/tags/0 /tags/2"},
+		{"несколько полей", valid(func(t *domain.Task) {
+			t.Title, t.Date, t.Repeat, t.Tags = "", "2024", "x", []string{"ok", "!"}
+		}), domain.ErrValidation, "/title /date /repeat /tags/1"},
+	}
+	for _, tt := range tests {
+		_, cErr := validateTask(tt.task)
+		if tt.err == nil {
+			if cErr != nil {
+				t.Errorf("%s: %v %v", tt.name, cErr.Err, cErr.Fields)
+			}
+			continue
+		}
+		if cErr == nil || cErr.Err != tt.err {
+			t.Errorf("%s: %v, ожидалось %v", tt.name, cErr, tt.err)
+			continue
+		}
+		if got := pointers(cErr); got != tt.pointers {
+			t.Errorf("%s: указатели %q, ожидалось %q", tt.name, got, tt.pointers)
+		}
+		for _, field := range cErr.Fields {
+			if field.Code == "" || field.Detail == "" {
+				t.Errorf("%s: нарушение без кода или текста: %+v", tt.name, field)
+			}
+		}
+	}
+}
+
+func TestValidateTaskRepeatRule(t *testing.T) {
+	rule, cErr := validateTask(&domain.Task{Title: "Отчет", Repeat: "w 1,3"})
+	if cErr != nil || rule == nil {
+		t.Fatalf("правило не разобрано: %v, %v", rule, cErr)
+	}
+	_, cErr = validateTask(&domain.Task{Title: "Отчет", Repeat: "x"})
+	if cErr == nil || len(cErr.Fields) != 1 || cErr.Fields[0].Pointer != "/repeat" || domain.KindOf(cErr.Err) != domain.KindValidation {
+		t.Errorf("некорректное правило: %v", cErr)
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tags := func(tags ...string) *[]string { return &tags }
+	priority := 7
+
+	tests := []struct {
+		name     string
+		input    domain.TaskInput
+		err      *domain.Error
+		pointers string
+	}{
+		// Проверяются только переданные поля: пустой ввод корректен
+		{"пустой ввод", domain.TaskInput{}, nil, ""},
+		{"заголовок", domain.TaskInput{Title: str("Отчет")}, nil, ""},
+		{"пустой заголовок", domain.TaskInput{Title: str("")}, domain.ErrBadTitle, "/title"},
+		{"очистка даты", domain.TaskInput{Date: str("")}, nil, ""},
+		{"тег", domain.TaskInput{Tags: tags("ok", "a b")}, domain.ErrTag, "/tags/1"},
+		{"несколько полей", domain.TaskInput{Date: str("завтра"), Repeat: str("z"), Priority: &priority},
+			domain.ErrValidation, "/date /repeat /priority"},
+	}
+	for _, tt := range tests {
+		cErr := validateInput(&tt.input)
+		if tt.err == nil {
+			if cErr != nil {
+				t.Errorf("%s: %v %v", tt.name, cErr.Err, cErr.Fields)
+			}
+			continue
+		}
+		if cErr == nil || cErr.Err != tt.err || pointers(cErr) != tt.pointers {
+			t.Errorf("%s: %v %q, ожидалось %v %q", tt.name, cErr, pointers(cErr), tt.err, tt.pointers)
+		}
+	}
+}
+
+// Ошибка правила повторения учитывается в метриках, даже если она
+// одна из нескольких; другие нарушения счетчик не трогают
+func TestRepeatRuleErrorMetric(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+	metrics := &taskMetrics{}
+	s := NewService(memory.NewTaskStore(), WithClock(FixedClock(now)), WithMetrics(metrics))
+
+	id, cErr := s.Create(ctx, &domain.Task{Title: "Отчет"})
+	if cErr != nil {
+		t.Fatal(cErr)
+	}
+
+	repeat, empty := "x", ""
+	steps := []struct {
+		name string
+		run  func() *domain.CustomError
+		want int
+	}{
+		{"create с пустым заголовком", func() *domain.CustomError {
+			_, cErr := s.Create(ctx, &domain.Task{Title: ""})
+			return cErr
+		}, 0},
+		{"create с неверным правилом", func() *domain.CustomError {
+			_, cErr := s.Create(ctx, &domain.Task{Title: "Отчет", Repeat: "x"})
+			return cErr
+		}, 1},
+		{"create с несколькими нарушениями", func() *domain.CustomError {
+			_, cErr := s.Create(ctx, &domain.Task{Repeat: "x", Date: "2024"})
+			return cErr
+		}, 2},
+		{"patch с неверным правилом", func() *domain.CustomError {
+			_, cErr := s.Patch(ctx, int(id), &domain.TaskInput{Repeat: &repeat}, 0)
+			return cErr
+		}, 3},
+		{"patch с пустым заголовком", func() *domain.CustomError {
+			_, cErr := s.Patch(ctx, int(id), &domain.TaskInput{Title: &empty}, 0)
+			return cErr
+		}, 3},
+	}
+	for _, step := range steps {
+		if cErr := step.run(); cErr == nil {
+			t.Fatalf("%s: ошибка не возвращена", step.name)
+		}
+		if metrics.repeatErrors != step.want {
+			t.Errorf("%s: ошибок правил %d, ожидалось %d", step.name, metrics.repeatErrors, step.want)
+		}
+	}
+}
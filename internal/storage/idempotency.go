@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// ReserveIdempotencyKey вставляет запись или занимает истекшую одним запросом,
+// поэтому два одновременных запроса с одним ключом не выполнятся оба
+func (s *Storage) ReserveIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	var reserved bool
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO idempotency_keys (key, request_hash, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET request_hash = EXCLUDED.request_hash, completed = false,
+			status = 0, header = '{}', body = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+		RETURNING true`,
+		record.Key, record.RequestHash, record.ExpiresAt).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	var existing domain.IdempotencyRecord
+	err = s.db.QueryRow(ctx,
+		"SELECT key, request_hash, completed, status, header, body, expires_at FROM idempotency_keys WHERE key = $1",
+		record.Key).Scan(&existing.Key, &existing.RequestHash, &existing.Completed, &existing.Status,
+		&existing.Header, &existing.Body, &existing.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Запись успели освободить - пробуем занять еще раз
+		return s.ReserveIdempotencyKey(ctx, record)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, record *domain.IdempotencyRecord) error {
+	_, err := s.db.Exec(ctx,
+		`UPDATE idempotency_keys SET completed = true, status = $1, header = $2, body = $3, expires_at = $4
+		WHERE key = $5 AND NOT completed`,
+		record.Status, record.Header, record.Body, record.ExpiresAt, record.Key)
+	return err
+}
+
+func (s *Storage) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, "DELETE FROM idempotency_keys WHERE key = $1", key)
+	return err
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) FindIdentity(ctx context.Context, issuer, subject string) (*domain.Identity, error) {
+	var identity domain.Identity
+	err := s.db.QueryRow(ctx,
+		"SELECT issuer, subject, email, account, created_at FROM identities WHERE issuer = $1 AND subject = $2", issuer, subject).
+		Scan(&identity.Issuer, &identity.Subject, &identity.Email, &identity.Account, &identity.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *Storage) SaveIdentity(ctx context.Context, identity *domain.Identity) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO identities (issuer, subject, email, account, created_at) VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (issuer, subject) DO UPDATE SET email = $3`,
+		identity.Issuer, identity.Subject, identity.Email, identity.Account, identity.CreatedAt)
+	return err
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) GetLoginState(ctx context.Context, key string) (*domain.LoginState, error) {
+	var state domain.LoginState
+	err := s.db.QueryRow(ctx,
+		"SELECT failures, last_failure, locked_until FROM login_state WHERE key = $1", key).
+		Scan(&state.Failures, &state.LastFailure, &state.LockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// IncrementLoginFailures увеличивает счетчик одним запросом, поэтому
+// одновременные ошибки входа не теряются
+func (s *Storage) IncrementLoginFailures(ctx context.Context, key string, now time.Time, window time.Duration) (*domain.LoginState, error) {
+	var state domain.LoginState
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO login_state (key, failures, last_failure, locked_until) VALUES ($1, 1, $2, $2)
+		ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_state.last_failure < $3 THEN 1 ELSE login_state.failures + 1 END,
+		last_failure = $2
+		RETURNING failures, last_failure, locked_until`,
+		key, now, now.Add(-window)).
+		Scan(&state.Failures, &state.LastFailure, &state.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *Storage) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.Exec(ctx,
+		"UPDATE login_state SET locked_until = GREATEST(locked_until, $2) WHERE key = $1", key, until)
+	return err
+}
+
+func (s *Storage) ResetLoginState(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, "DELETE FROM login_state WHERE key = $1", key)
+	return err
+}
+
+func (s *Storage) RecordLoginAttempt(ctx context.Context, attempt *domain.LoginAttempt) error {
+	_, err := s.db.Exec(ctx,
+		"INSERT INTO login_attempts (account, ip, success, at) VALUES ($1,$2,$3,$4)",
+		attempt.Account, attempt.IP, attempt.Success, attempt.At)
+	return err
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// IdempotencyStore хранит ответы на запросы с Idempotency-Key в памяти процесса.
+// Истекшие записи удаляются при очередном резервировании.
+type IdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]domain.IdempotencyRecord
+}
+
+func NewIdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{records: make(map[string]domain.IdempotencyRecord)}
+}
+
+func (s *IdempotencyStore) ReserveIdempotencyKey(_ context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, r := range s.records {
+		if !r.ExpiresAt.After(now) {
+			delete(s.records, key)
+		}
+	}
+	if existing, ok := s.records[record.Key]; ok {
+		return &existing, nil
+	}
+	s.records[record.Key] = *record
+	return nil, nil
+}
+
+func (s *IdempotencyStore) CompleteIdempotencyKey(_ context.Context, record *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.records[record.Key]
+	if !ok || stored.Completed {
+		return nil
+	}
+	stored.Completed = true
+	stored.Status, stored.Header, stored.Body = record.Status, record.Header, record.Body
+	stored.ExpiresAt = record.ExpiresAt
+	s.records[record.Key] = stored
+	return nil
+}
+
+func (s *IdempotencyStore) ReleaseIdempotencyKey(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// auditLimit - сколько последних попыток входа хранится в памяти
+const auditLimit int = 1000
+
+// sweepInterval - как часто удаляются устаревшие счетчики
+const sweepInterval time.Duration = time.Minute
+
+// LoginStore хранит счетчики попыток входа в памяти процесса.
+// Подходит для одного экземпляра сервера; при перезапуске данные теряются.
+// Счетчик без ошибок дольше окна и без действующей блокировки удаляется,
+// чтобы перебор с разных IP не занимал память бесконечно.
+type LoginStore struct {
+	mu       sync.Mutex
+	states   map[string]domain.LoginState
+	attempts []domain.LoginAttempt
+	sweptAt  time.Time
+}
+
+func NewLoginStore() *LoginStore {
+	return &LoginStore{states: make(map[string]domain.LoginState)}
+}
+
+func (s *LoginStore) GetLoginState(_ context.Context, key string) (*domain.LoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (s *LoginStore) IncrementLoginFailures(_ context.Context, key string, now time.Time, window time.Duration) (*domain.LoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, window)
+	state, ok := s.states[key]
+	if !ok || now.Sub(state.LastFailure) > window {
+		state = domain.LoginState{LockedUntil: state.LockedUntil}
+	}
+	state.Failures++
+	state.LastFailure = now
+	s.states[key] = state
+	return &state, nil
+}
+
+func (s *LoginStore) LockLogin(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[key]
+	if ok && until.After(state.LockedUntil) {
+		state.LockedUntil = until
+		s.states[key] = state
+	}
+	return nil
+}
+
+// sweep удаляет устаревшие счетчики не чаще раза в sweepInterval
+func (s *LoginStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(s.sweptAt) < sweepInterval {
+		return
+	}
+	s.sweptAt = now
+	for key, state := range s.states {
+		if now.Sub(state.LastFailure) > window && !state.LockedUntil.After(now) {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (s *LoginStore) ResetLoginState(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.states, key)
+	return nil
+}
+
+func (s *LoginStore) RecordLoginAttempt(_ context.Context, attempt *domain.LoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.attempts) >= auditLimit {
+		s.attempts = s.attempts[1:]
+	}
+	s.attempts = append(s.attempts, *attempt)
+	return nil
+}
+
+// Attempts возвращает копию журнала попыток входа
+func (s *LoginStore) Attempts() []domain.LoginAttempt {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]domain.LoginAttempt(nil), s.attempts...)
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoginStoreEvictsStaleStates(t *testing.T) {
+	s := NewLoginStore()
+	ctx := context.Background()
+	window := time.Hour
+	start := time.Date(2024, time.January, 26, 12, 0, 0, 0, time.UTC)
+
+	if _, err := s.IncrementLoginFailures(ctx, "ip:stale", start, window); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.IncrementLoginFailures(ctx, "ip:locked", start, window); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LockLogin(ctx, "ip:locked", start.Add(3*window)); err != nil {
+		t.Fatal(err)
+	}
+
+	later := start.Add(2 * window)
+	state, err := s.IncrementLoginFailures(ctx, "ip:fresh", later, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != 1 {
+		t.Errorf("Failures = %d", state.Failures)
+	}
+	if _, ok := s.states["ip:stale"]; ok {
+		t.Error("устаревший счетчик не удален")
+	}
+	if _, ok := s.states["ip:locked"]; !ok {
+		t.Error("удален счетчик с действующей блокировкой")
+	}
+
+	// Ошибка после окна начинает счет заново, но не снимает блокировку
+	state, err = s.IncrementLoginFailures(ctx, "ip:locked", later, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != 1 || !state.LockedUntil.Equal(start.Add(3*window)) {
+		t.Errorf("после окна: %+v", state)
+	}
+	if err := s.LockLogin(ctx, "ip:locked", later); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.states["ip:locked"].LockedUntil; !got.Equal(start.Add(3 * window)) {
+		t.Errorf("LockLogin сократил блокировку до %v", got)
+	}
+}
@@ -0,0 +1,256 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// TaskStore - хранилище задач в памяти процесса с той же семантикой, что и
+// storage.Storage. Подходит для разработки и тестов.
+type TaskStore struct {
+	mu     sync.Mutex
+	tasks  map[int64]domain.Task
+	nextID int64
+}
+
+// Проверка на этапе компиляции
+var _ domain.TaskRepository = (*TaskStore)(nil)
+
+func NewTaskStore() *TaskStore {
+	return &TaskStore{tasks: make(map[int64]domain.Task), nextID: 1}
+}
+
+func (s *TaskStore) FindTask(_ context.Context, filter *domain.Filter) ([]*domain.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.find(filter), nil
+}
+
+func (s *TaskStore) CountTasks(_ context.Context, filters []*domain.Filter) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count(filters), nil
+}
+
+func (s *TaskStore) CreateTask(_ context.Context, task *domain.Task) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(task), nil
+}
+
+func (s *TaskStore) UpdateTask(_ context.Context, task *domain.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(task)
+}
+
+func (s *TaskStore) DeleteTask(_ context.Context, id *int, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(int64(*id), version)
+}
+
+func (s *TaskStore) CloseDB() {}
+
+// WithTx держит блокировку хранилища все время выполнения fn, поэтому другие
+// запросы ждут окончания транзакции, а откат к снимку не затирает их записи
+func (s *TaskStore) WithTx(_ context.Context, fn func(repo domain.TaskRepository) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return txStore{s}.savepoint(fn)
+}
+
+// Методы ниже вызываются под s.mu
+
+func (s *TaskStore) find(filter *domain.Filter) []*domain.Task {
+	tasks := s.match(filter)
+	less := sortLess(filter.Sort)
+	sort.Slice(tasks, func(i, j int) bool {
+		return less(tasks[i], tasks[j])
+	})
+	if filter.After != nil {
+		last := cursorTask(filter.After)
+		for len(tasks) > 0 && !less(last, tasks[0]) {
+			tasks = tasks[1:]
+		}
+	}
+	if filter.Limit > 0 && len(tasks) > filter.Limit {
+		tasks = tasks[:filter.Limit]
+	}
+	return tasks
+}
+
+func (s *TaskStore) count(filters []*domain.Filter) []int {
+	counts := make([]int, len(filters))
+	for i, filter := range filters {
+		counts[i] = len(s.match(filter))
+	}
+	return counts
+}
+
+// match отбирает задачи по условиям фильтра, кроме курсора
+func (s *TaskStore) match(filter *domain.Filter) []*domain.Task {
+	tasks := make([]*domain.Task, 0)
+	for id, stored := range s.tasks {
+		task := stored
+		task.Tags = slices.Clone(stored.Tags)
+		if filter.ID != nil && id != int64(*filter.ID) {
+			continue
+		}
+		if filter.SearchTerm != "" && !containsFold(task.Title, filter.SearchTerm) && !containsFold(task.Comment, filter.SearchTerm) {
+			continue
+		}
+		if filter.Date != "" && task.Date != filter.Date {
+			continue
+		}
+		if filter.From != "" && task.Date < filter.From || filter.To != "" && task.Date > filter.To {
+			continue
+		}
+		if filter.NoRepeat && task.Repeat != "" {
+			continue
+		}
+		if filter.Query != nil && !filter.Query.Match(&task) {
+			continue
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks
+}
+
+func (s *TaskStore) create(task *domain.Task) int64 {
+	id := s.nextID
+	s.nextID++
+	task.Version = 1
+	stored := *task
+	stored.ID = strconv.FormatInt(id, 10)
+	stored.Tags = slices.Clone(task.Tags)
+	s.tasks[id] = stored
+	return id
+}
+
+func (s *TaskStore) update(task *domain.Task) error {
+	id, err := strconv.ParseInt(task.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("id задачи не найден: %w", domain.ErrNotFound)
+	}
+	stored, err := s.check(id, task.Version)
+	if err != nil {
+		return err
+	}
+	task.Version = stored.Version + 1
+	updated := *task
+	updated.Tags = slices.Clone(task.Tags)
+	s.tasks[id] = updated
+	return nil
+}
+
+func (s *TaskStore) delete(id, version int64) error {
+	if _, err := s.check(id, version); err != nil {
+		return err
+	}
+	delete(s.tasks, id)
+	return nil
+}
+
+// txStore - хранилище внутри транзакции. Блокировку уже держит WithTx,
+// поэтому методы обращаются к данным напрямую. Вложенный WithTx работает
+// как точка сохранения.
+type txStore struct {
+	s *TaskStore
+}
+
+func (t txStore) FindTask(_ context.Context, filter *domain.Filter) ([]*domain.Task, error) {
+	return t.s.find(filter), nil
+}
+
+func (t txStore) CountTasks(_ context.Context, filters []*domain.Filter) ([]int, error) {
+	return t.s.count(filters), nil
+}
+
+func (t txStore) CreateTask(_ context.Context, task *domain.Task) (int64, error) {
+	return t.s.create(task), nil
+}
+
+func (t txStore) UpdateTask(_ context.Context, task *domain.Task) error {
+	return t.s.update(task)
+}
+
+func (t txStore) DeleteTask(_ context.Context, id *int, version int64) error {
+	return t.s.delete(int64(*id), version)
+}
+
+func (t txStore) CloseDB() {}
+
+func (t txStore) WithTx(_ context.Context, fn func(repo domain.TaskRepository) error) error {
+	return t.savepoint(fn)
+}
+
+// savepoint запоминает состояние и восстанавливает его, если fn вернула ошибку
+func (t txStore) savepoint(fn func(repo domain.TaskRepository) error) error {
+	tasks, nextID := maps.Clone(t.s.tasks), t.s.nextID
+	if err := fn(t); err != nil {
+		t.s.tasks, t.s.nextID = tasks, nextID
+		return err
+	}
+	return nil
+}
+
+// check проверяет, что задача есть и (при ненулевой версии) не менялась
+func (s *TaskStore) check(id, version int64) (domain.Task, error) {
+	stored, ok := s.tasks[id]
+	if !ok {
+		return stored, fmt.Errorf("id задачи не найден: %w", domain.ErrNotFound)
+	}
+	if version != 0 && stored.Version != version {
+		return stored, fmt.Errorf("версия задачи изменилась: %w", domain.ErrVersion)
+	}
+	return stored, nil
+}
+
+// sortLess - порядок задач как в ORDER BY хранилища PostgreSQL
+func sortLess(order domain.Sort) func(a, b *domain.Task) bool {
+	key := func(t *domain.Task) string { return t.Date }
+	if order == domain.SortTitle || order == domain.SortTitleDesc {
+		key = func(t *domain.Task) string { return t.Title }
+	}
+	desc := order == domain.SortDateDesc || order == domain.SortTitleDesc
+	return func(a, b *domain.Task) bool {
+		ka, kb := key(a), key(b)
+		if ka == kb {
+			if desc {
+				return taskID(a) > taskID(b)
+			}
+			return taskID(a) < taskID(b)
+		}
+		if desc {
+			return ka > kb
+		}
+		return ka < kb
+	}
+}
+
+// cursorTask восстанавливает из курсора ключи последней задачи страницы
+func cursorTask(cursor *domain.Cursor) *domain.Task {
+	task := &domain.Task{ID: strconv.Itoa(cursor.ID), Date: cursor.Date}
+	if cursor.Title != nil {
+		task.Title = *cursor.Title
+	}
+	return task
+}
+
+func taskID(task *domain.Task) int64 {
+	id, _ := strconv.ParseInt(task.ID, 10, 64)
+	return id
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
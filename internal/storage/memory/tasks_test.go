@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// Откат транзакции не должен затирать запись, сделанную вне нее
+func TestWithTxRollbackKeepsConcurrentWrites(t *testing.T) {
+	store := NewTaskStore()
+	ctx := context.Background()
+	started := make(chan struct{})
+	written := make(chan int64)
+	errRollback := errors.New("откат")
+
+	go func() {
+		<-started
+		id, _ := store.CreateTask(ctx, &domain.Task{Date: "20240126", Title: "outside"})
+		written <- id
+	}()
+
+	err := store.WithTx(ctx, func(repo domain.TaskRepository) error {
+		if _, err := repo.CreateTask(ctx, &domain.Task{Date: "20240126", Title: "inside"}); err != nil {
+			return err
+		}
+		close(started)
+		// Даем записи снаружи шанс вклиниться, если транзакция ее не блокирует
+		time.Sleep(20 * time.Millisecond)
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("WithTx = %v", err)
+	}
+
+	id := <-written
+	tasks, err := store.FindTask(ctx, &domain.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "outside" || taskID(tasks[0]) != id {
+		t.Errorf("после отката остались задачи %+v, ожидалась только запись снаружи", tasks)
+	}
+}
+
+func TestWithTxNestedSavepoint(t *testing.T) {
+	store := NewTaskStore()
+	ctx := context.Background()
+
+	err := store.WithTx(ctx, func(repo domain.TaskRepository) error {
+		if _, err := repo.CreateTask(ctx, &domain.Task{Date: "20240126", Title: "outer"}); err != nil {
+			return err
+		}
+		inner := repo.WithTx(ctx, func(repo domain.TaskRepository) error {
+			_, _ = repo.CreateTask(ctx, &domain.Task{Date: "20240126", Title: "inner"})
+			return errors.New("откат вложенной")
+		})
+		if inner == nil {
+			t.Error("ошибка вложенной транзакции потеряна")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, _ := store.CountTasks(ctx, []*domain.Filter{{}})
+	if counts[0] != 1 {
+		t.Errorf("задач %d, ожидалась одна из внешней транзакции", counts[0])
+	}
+}
@@ -0,0 +1,82 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// TwoFactorStore хранит настройки 2FA в памяти процесса
+type TwoFactorStore struct {
+	mu      sync.Mutex
+	records map[string]domain.TwoFactor
+}
+
+// Проверка на этапе компиляции
+var _ domain.TwoFactorRepository = (*TwoFactorStore)(nil)
+
+func NewTwoFactorStore() *TwoFactorStore {
+	return &TwoFactorStore{records: make(map[string]domain.TwoFactor)}
+}
+
+func (s *TwoFactorStore) GetTwoFactor(_ context.Context, account string) (*domain.TwoFactor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.records[account]
+	if !ok {
+		return nil, nil
+	}
+	tf.RecoveryCodes = slices.Clone(tf.RecoveryCodes)
+	return &tf, nil
+}
+
+func (s *TwoFactorStore) SaveTwoFactor(_ context.Context, tf *domain.TwoFactor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *tf
+	stored.RecoveryCodes = slices.Clone(tf.RecoveryCodes)
+	s.records[tf.Account] = stored
+	return nil
+}
+
+func (s *TwoFactorStore) DeleteTwoFactor(_ context.Context, account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, account)
+	return nil
+}
+
+func (s *TwoFactorStore) AdvanceTOTPStep(_ context.Context, account string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.records[account]
+	if !ok || tf.LastStep >= step {
+		return false, nil
+	}
+	tf.LastStep = step
+	s.records[account] = tf
+	return true, nil
+}
+
+func (s *TwoFactorStore) UseRecoveryCode(_ context.Context, account, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.records[account]
+	if !ok {
+		return false, nil
+	}
+	i := slices.Index(tf.RecoveryCodes, hash)
+	if i < 0 {
+		return false, nil
+	}
+	tf.RecoveryCodes = slices.Delete(slices.Clone(tf.RecoveryCodes), i, i+1)
+	s.records[account] = tf
+	return true, nil
+}
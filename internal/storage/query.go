@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// searchConfig - конфигурация полнотекстового поиска из миграции 000007
+const searchConfig = "todo_search"
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// queryBuilder собирает условия WHERE с позиционными параметрами
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (b *queryBuilder) arg(value interface{}) string {
+	b.args = append(b.args, value)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *queryBuilder) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// filter добавляет условия в зависимости от фильтра, кроме курсора
+func (b *queryBuilder) filter(filter *domain.Filter) {
+	if filter.ID != nil {
+		b.where("id = " + b.arg(*filter.ID))
+	}
+	if filter.SearchTerm != "" {
+		searchPattern := b.arg("%" + filter.SearchTerm + "%")
+		b.where("(title ILIKE " + searchPattern + " OR comment ILIKE " + searchPattern + ")")
+	}
+	if filter.Date != "" {
+		b.where("date = " + b.arg(filter.Date))
+	}
+	if filter.From != "" {
+		b.where("date >= " + b.arg(filter.From))
+	}
+	if filter.To != "" {
+		b.where("date <= " + b.arg(filter.To))
+	}
+	if filter.NoRepeat {
+		b.where("repeat = ''")
+	}
+	if filter.Query != nil {
+		b.compileQuery(filter.Query)
+	}
+}
+
+// sortColumn возвращает колонку сортировки и признак обратного порядка
+func sortColumn(sort domain.Sort) (string, bool) {
+	switch sort {
+	case domain.SortDateDesc:
+		return "date", true
+	case domain.SortTitle:
+		return "title", false
+	case domain.SortTitleDesc:
+		return "title", true
+	}
+	return "date", false
+}
+
+// compileQuery переводит разобранный запрос в условия SQL. Семантика
+// совпадает с domain.Query.Match, кроме слов и фраз без поля: кроме подстроки
+// SQL находит еще словоформы и похожие по триграммам слова, поэтому находит
+// не меньше задач, чем Match.
+func (b *queryBuilder) compileQuery(q *domain.Query) {
+	for _, term := range q.Terms {
+		condition := b.term(term, q.Today)
+		if term.Negate {
+			condition = "NOT " + condition
+		}
+		b.where(condition)
+	}
+}
+
+func (b *queryBuilder) term(t domain.QueryTerm, today string) string {
+	switch t.Field {
+	case domain.FieldText:
+		pattern := b.arg(likePattern(t.Value))
+		substring := "title ILIKE " + pattern + ` ESCAPE '\' OR comment ILIKE ` + pattern + ` ESCAPE '\'`
+		if t.Negate {
+			// Исключаем только точные вхождения, иначе похожие слова отсекут лишнее
+			return "(" + substring + ")"
+		}
+		value := b.arg(t.Value)
+		condition := substring + " OR search @@ " + tsquery(t, value)
+		if !t.Phrase {
+			// Опечатки: похожесть по триграммам, порог - pg_trgm.word_similarity_threshold
+			condition += " OR " + value + " <% title OR " + value + " <% comment"
+		}
+		return "(" + condition + ")"
+	case domain.FieldTitle, domain.FieldComment:
+		return "(" + string(t.Field) + " ILIKE " + b.arg(likePattern(t.Value)) + ` ESCAPE '\')`
+	case domain.FieldTag:
+		pattern := `(^|\s)#` + regexp.QuoteMeta(t.Value) + `($|[^[:alnum:]_-])`
+		return "(" + b.arg(t.Value) + " = ANY(tags) OR (title || ' ' || comment) ~* " + b.arg(pattern) + ")"
+	case domain.FieldDue:
+		if t.Op == domain.OpBetween {
+			from, to := t.DateRange()
+			var bounds []string
+			if from != "" {
+				bounds = append(bounds, "date >= "+b.arg(from))
+			}
+			if to != "" {
+				bounds = append(bounds, "date <= "+b.arg(to))
+			}
+			if len(bounds) == 0 {
+				return "TRUE"
+			}
+			return "(" + strings.Join(bounds, " AND ") + ")"
+		}
+		return "(date " + sqlOp(t.Op) + " " + b.arg(t.Value) + ")"
+	case domain.FieldRepeat:
+		if t.Value == domain.RepeatNone {
+			return "(repeat = '')"
+		}
+		return "(repeat = " + b.arg(t.Value) + " OR repeat LIKE " + b.arg(t.Value+" %") + ")"
+	case domain.FieldStatus:
+		if t.Value == domain.StatusOverdue {
+			return "(date < " + b.arg(today) + ")"
+		}
+		return "(date >= " + b.arg(today) + ")"
+	}
+	return "FALSE"
+}
+
+// tsquery строит запрос полнотекстового поиска для слова или фразы
+func tsquery(t domain.QueryTerm, value string) string {
+	if t.Phrase {
+		return "phraseto_tsquery('" + searchConfig + "', " + value + ")"
+	}
+	return "plainto_tsquery('" + searchConfig + "', " + value + ")"
+}
+
+func sqlOp(op domain.QueryOp) string {
+	switch op {
+	case domain.OpLt, domain.OpLte, domain.OpGt, domain.OpGte:
+		return string(op)
+	}
+	return "="
+}
+
+func likePattern(value string) string {
+	return "%" + likeEscaper.Replace(value) + "%"
+}
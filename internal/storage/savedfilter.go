@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation - код ошибки PostgreSQL при нарушении UNIQUE
+const uniqueViolation = "23505"
+
+func (s *Storage) CreateSavedFilter(ctx context.Context, filter *domain.SavedFilter) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(ctx,
+		"INSERT INTO saved_filters (name, filter) VALUES ($1, $2) RETURNING id, created_at, updated_at",
+		filter.Name, filter.Filter).Scan(&id, &filter.CreatedAt, &filter.UpdatedAt)
+	if err != nil {
+		return 0, filterError(err)
+	}
+	return id, nil
+}
+
+func (s *Storage) GetSavedFilter(ctx context.Context, id int64) (*domain.SavedFilter, error) {
+	row := s.db.QueryRow(ctx,
+		"SELECT id, name, filter, created_at, updated_at FROM saved_filters WHERE id = $1", id)
+	filter, err := scanSavedFilter(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("id фильтра не найден в БД: %w", domain.ErrFilterNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (s *Storage) ListSavedFilters(ctx context.Context) ([]*domain.SavedFilter, error) {
+	filters := make([]*domain.SavedFilter, 0)
+	rows, err := s.db.Query(ctx,
+		"SELECT id, name, filter, created_at, updated_at FROM saved_filters ORDER BY name, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		filter, err := scanSavedFilter(rows)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return filters, nil
+}
+
+func (s *Storage) UpdateSavedFilter(ctx context.Context, filter *domain.SavedFilter) error {
+	err := s.db.QueryRow(ctx,
+		"UPDATE saved_filters SET name = $1, filter = $2, updated_at = now() WHERE id = $3 RETURNING created_at, updated_at",
+		filter.Name, filter.Filter, filter.ID).Scan(&filter.CreatedAt, &filter.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("id фильтра не найден в БД: %w", domain.ErrFilterNotFound)
+	}
+	if err != nil {
+		return filterError(err)
+	}
+	return nil
+}
+
+func (s *Storage) DeleteSavedFilter(ctx context.Context, id int64) error {
+	res, err := s.db.Exec(ctx, "DELETE FROM saved_filters WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("id фильтра не найден в БД: %w", domain.ErrFilterNotFound)
+	}
+	return nil
+}
+
+func scanSavedFilter(row pgx.Row) (*domain.SavedFilter, error) {
+	var f domain.SavedFilter
+	if err := row.Scan(&f.ID, &f.Name, &f.Filter, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func filterError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%s: %w", pgErr.ConstraintName, domain.ErrFilterExists)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+)
+
+// ts_headline не экранирует текст задачи, поэтому совпадения сначала
+// обрамляются символами из области частного использования Unicode, а после
+// экранирования HTML заменяются на <mark></mark>
+const (
+	markStart       = "\uE000"
+	markStop        = "\uE001"
+	headlineOptions = "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxWords=20, MinWords=5, MaxFragments=2"
+)
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// highlight экранирует фрагмент ts_headline и расставляет теги подсветки
+func highlight(fragment string) string {
+	return markReplacer.Replace(html.EscapeString(fragment))
+}
+
+// searchTasks выполняет запрос с полнотекстовыми условиями: для каждой задачи
+// возвращаются релевантность и подсвеченные фрагменты. Без явной сортировки
+// задачи упорядочены по релевантности, иначе - по filter.Sort.
+// Условия фильтра уже собраны в b, terms - слова и фразы для ранжирования.
+func (s *Storage) searchTasks(ctx context.Context, b *queryBuilder, terms []domain.QueryTerm, filter *domain.Filter) ([]*domain.Task, error) {
+	queries := make([]string, 0, len(terms))
+	values := make([]string, 0, len(terms))
+	for _, term := range terms {
+		queries = append(queries, tsquery(term, b.arg(term.Value)))
+		values = append(values, term.Value)
+	}
+	tsq := "(" + strings.Join(queries, " && ") + ")"
+	// Совпадения только по триграммам получают небольшой ранг от похожести
+	rank := "(ts_rank_cd(search, " + tsq + ") + 0.1 * word_similarity(" +
+		b.arg(strings.Join(values, " ")) + ", title || ' ' || comment))::real"
+
+	options := b.arg(headlineOptions)
+	query := "SELECT id, date, title, comment, repeat, tags, priority, version, rank, " +
+		"ts_headline('" + searchConfig + "', title, " + tsq + ", " + options + "), " +
+		"ts_headline('" + searchConfig + "', comment, " + tsq + ", " + options + ") " +
+		"FROM (SELECT id, date, title, comment, repeat, tags, priority, version, " + rank + " AS rank FROM scheduler"
+	if len(b.conditions) > 0 {
+		query += " WHERE " + strings.Join(b.conditions, " AND ")
+	}
+	query += ") found"
+	if filter.Sort != "" {
+		after, order := sortKeyset(b, filter)
+		if after != "" {
+			query += " WHERE " + after
+		}
+		query += " ORDER BY " + order
+	} else {
+		//Keyset-пагинация по (rank DESC, date, id)
+		if filter.After != nil && filter.After.Rank != nil {
+			r := b.arg(*filter.After.Rank)
+			query += " WHERE (rank < " + r + "::real OR (rank = " + r + "::real AND (date, id) > (" +
+				b.arg(filter.After.Date) + ", " + b.arg(filter.After.ID) + ")))"
+		}
+		query += " ORDER BY rank DESC, date, id"
+	}
+	if filter.Limit > 0 {
+		query += " LIMIT " + b.arg(filter.Limit)
+	}
+
+	rows, err := s.db.Query(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := make([]*domain.Task, 0)
+	for rows.Next() {
+		t := domain.Task{Match: &domain.SearchMatch{}}
+		err = rows.Scan(&t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat, &t.Tags, &t.Priority, &t.Version,
+			&t.Match.Rank, &t.Match.Title, &t.Match.Comment)
+		if err != nil {
+			return nil, err
+		}
+		t.Match.Title = highlight(t.Match.Title)
+		t.Match.Comment = highlight(t.Match.Comment)
+		tasks = append(tasks, &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
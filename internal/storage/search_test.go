@@ -0,0 +1,20 @@
+package storage
+
+import "testing"
+
+func TestHighlightEscapesTaskText(t *testing.T) {
+	tests := []struct {
+		fragment string
+		want     string
+	}{
+		{"plain " + markStart + "report" + markStop, "plain <mark>report</mark>"},
+		{`<img src=x onerror="alert(1)"> ` + markStart + "report" + markStop,
+			`&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>report</mark>`},
+		{"</mark><script>", "&lt;/mark&gt;&lt;script&gt;"},
+	}
+	for _, tt := range tests {
+		if got := highlight(tt.fragment); got != tt.want {
+			t.Errorf("highlight(%q) = %q, ожидалось %q", tt.fragment, got, tt.want)
+		}
+	}
+}
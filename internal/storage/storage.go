@@ -2,43 +2,64 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// querier - общие методы пула и транзакции pgx
+type querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// Storage выполняет запросы через db: пул соединений или, внутри WithTx, транзакцию
 type Storage struct {
 	pool *pgxpool.Pool
+	db   querier
 }
 
-func NewPool(ctx context.Context, dsn string) *Storage {
+// NewPool подключается к БД и проверяет соединение
+func NewPool(ctx context.Context, dsn string) (*Storage, error) {
 	cfg, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		log.Fatalf("Unable to parse database URL: %v\n", err)
+		return nil, fmt.Errorf("unable to parse database URL: %w", err)
 	}
 
 	cfg.MaxConns = 10 // Set a maximum number of connections
 	cfg.MinConns = 1  // Set a minimum number of connections
 	cfg.HealthCheckPeriod = 30 * time.Second
+	cfg.ConnConfig.Tracer = queryTracer{}
 
 	pool, err := pgxpool.NewWithConfig(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Unable to create connection pool: %v\n", err)
+		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
 	// Check if the connection pool is working
 	err = pool.Ping(ctx)
 	if err != nil {
 		pool.Close()
-		log.Fatalf("Unable to connect to database: %v\n", err)
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	return &Storage{pool: pool}
+	return &Storage{pool: pool, db: pool}, nil
+}
+
+// Stat возвращает статистику пула соединений для метрик
+func (s *Storage) Stat() *pgxpool.Stat {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.Stat()
 }
 
 func (s *Storage) CloseDB() {
@@ -47,41 +68,52 @@ func (s *Storage) CloseDB() {
 	}
 }
 
-func (s *Storage) FindTask(ctx context.Context, filter *domain.Filter) ([]*domain.Task, error) {
-	tasks := make([]*domain.Task, 0)
-	query := "SELECT id, date, title, comment, repeat FROM scheduler"
-	args := []interface{}{}
-	conditions := []string{}
-	argIdx := 1
-
-	//Добавление условий в зависимости от фильтра
-	if filter.ID != nil {
-		conditions = append(conditions, "id = $"+strconv.Itoa(argIdx))
-		args = append(args, *filter.ID)
-		argIdx++
+// WithTx выполняет fn в транзакции: ошибка fn откатывает ее, иначе она фиксируется.
+// Вложенный WithTx создает точку сохранения. Хранилище, переданное в fn,
+// нельзя использовать после возврата из fn.
+func (s *Storage) WithTx(ctx context.Context, fn func(repo domain.TaskRepository) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
 	}
-	if filter.SearchTerm != "" {
-		searchPattern := "%" + filter.SearchTerm + "%"
-		conditions = append(conditions, "(title ILIKE $"+strconv.Itoa(argIdx)+" OR comment ILIKE $"+strconv.Itoa(argIdx+1)+")")
-		args = append(args, searchPattern, searchPattern)
-		argIdx += 2
+	defer func() {
+		// После Commit откат ничего не делает
+		_ = tx.Rollback(ctx)
+	}()
+
+	if err = fn(&Storage{db: tx}); err != nil {
+		return err
 	}
-	if filter.Date != "" {
-		conditions = append(conditions, "date = $"+strconv.Itoa(argIdx))
-		args = append(args, filter.Date)
-		argIdx++
+	return tx.Commit(ctx)
+}
+
+func (s *Storage) FindTask(ctx context.Context, filter *domain.Filter) ([]*domain.Task, error) {
+	tasks := make([]*domain.Task, 0)
+	query := "SELECT id, date, title, comment, repeat, tags, priority, version FROM scheduler"
+	b := &queryBuilder{}
+	b.filter(filter)
+	if filter.Query != nil {
+		if terms := filter.Query.TextTerms(); len(terms) > 0 {
+			return s.searchTasks(ctx, b, terms, filter)
+		}
 	}
 
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
+	after, order := sortKeyset(b, filter)
+	if after != "" {
+		b.where(after)
 	}
-	query += " ORDER BY date"
+	if len(b.conditions) > 0 {
+		query += " WHERE " + strings.Join(b.conditions, " AND ")
+	}
+	query += " ORDER BY " + order
 	if filter.Limit > 0 {
-		query += " LIMIT $" + strconv.Itoa(argIdx)
-		args = append(args, filter.Limit)
+		query += " LIMIT " + b.arg(filter.Limit)
+	}
+	if filter.ForUpdate {
+		query += " FOR UPDATE"
 	}
 
-	rows, err := s.pool.Query(ctx, query, args...)
+	rows, err := s.db.Query(ctx, query, b.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +122,7 @@ func (s *Storage) FindTask(ctx context.Context, filter *domain.Filter) ([]*domai
 
 	for rows.Next() {
 		var t domain.Task
-		err = rows.Scan(&t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat)
+		err = rows.Scan(&t.ID, &t.Date, &t.Title, &t.Comment, &t.Repeat, &t.Tags, &t.Priority, &t.Version)
 		if err != nil {
 			return nil, err
 		}
@@ -103,10 +135,59 @@ func (s *Storage) FindTask(ctx context.Context, filter *domain.Filter) ([]*domai
 	return tasks, nil
 }
 
+// sortKeyset возвращает условие keyset-пагинации (строки строго после
+// последней строки предыдущей страницы) и ORDER BY для filter.Sort
+func sortKeyset(b *queryBuilder, filter *domain.Filter) (after, order string) {
+	column, desc := sortColumn(filter.Sort)
+	cmp := ">"
+	order = column + ", id"
+	if desc {
+		cmp = "<"
+		order = column + " DESC, id DESC"
+	}
+	if filter.After != nil {
+		key := filter.After.Date
+		if column == "title" && filter.After.Title != nil {
+			key = *filter.After.Title
+		}
+		after = "(" + column + ", id) " + cmp + " (" + b.arg(key) + ", " + b.arg(filter.After.ID) + ")"
+	}
+	return after, order
+}
+
+// CountTasks считает все фильтры одним запросом: для каждого фильтра
+// своя колонка count(*) FILTER (WHERE ...)
+func (s *Storage) CountTasks(ctx context.Context, filters []*domain.Filter) ([]int, error) {
+	counts := make([]int, len(filters))
+	if len(filters) == 0 {
+		return counts, nil
+	}
+	columns := make([]string, len(filters))
+	dest := make([]any, len(filters))
+	var args []interface{}
+	for i, filter := range filters {
+		// Параметры всех фильтров нумеруются подряд в одном запросе
+		b := &queryBuilder{args: args}
+		b.filter(filter)
+		args = b.args
+		columns[i] = "count(*)"
+		if len(b.conditions) > 0 {
+			columns[i] += " FILTER (WHERE " + strings.Join(b.conditions, " AND ") + ")"
+		}
+		dest[i] = &counts[i]
+	}
+	query := "SELECT " + strings.Join(columns, ", ") + " FROM scheduler"
+	if err := s.db.QueryRow(ctx, query, args...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
 func (s *Storage) CreateTask(ctx context.Context, task *domain.Task) (int64, error) {
 	var id int64
-	err := s.pool.QueryRow(ctx, "INSERT INTO scheduler (date, title, comment, repeat) VALUES ($1,$2,$3,$4) RETURNING id",
-		task.Date, task.Title, task.Comment, task.Repeat).Scan(&id)
+	err := s.db.QueryRow(ctx,
+		"INSERT INTO scheduler (date, title, comment, repeat, tags, priority) VALUES ($1,$2,$3,$4,COALESCE($5::text[], '{}'),$6) RETURNING id, version",
+		task.Date, task.Title, task.Comment, task.Repeat, task.Tags, task.Priority).Scan(&id, &task.Version)
 	if err != nil {
 		return 0, err
 	}
@@ -115,26 +196,43 @@ func (s *Storage) CreateTask(ctx context.Context, task *domain.Task) (int64, err
 }
 
 func (s *Storage) UpdateTask(ctx context.Context, task *domain.Task) error {
-	res, err := s.pool.Exec(ctx,
-		"UPDATE scheduler SET date = $1, title = $2, comment = $3, repeat = $4 WHERE id = $5",
-		task.Date, task.Title, task.Comment, task.Repeat, task.ID)
+	var version int64
+	err := s.db.QueryRow(ctx,
+		`UPDATE scheduler SET date = $1, title = $2, comment = $3, repeat = $4,
+		tags = COALESCE($5::text[], '{}'), priority = $6, version = version + 1
+		WHERE id = $7 AND ($8::bigint = 0 OR version = $8) RETURNING version`,
+		task.Date, task.Title, task.Comment, task.Repeat, task.Tags, task.Priority, task.ID, task.Version).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s.missingOrConflict(ctx, task.ID)
+	}
 	if err != nil {
 		return err
 	}
-	if res.RowsAffected() == 0 {
-		return fmt.Errorf("id задачи не найден в БД")
-	}
+	task.Version = version
 	return nil
 }
 
-func (s *Storage) DeleteTask(ctx context.Context, id *int) error {
-	res, err := s.pool.Exec(ctx,
-		"DELETE FROM scheduler WHERE id = $1", id)
+func (s *Storage) DeleteTask(ctx context.Context, id *int, version int64) error {
+	res, err := s.db.Exec(ctx,
+		"DELETE FROM scheduler WHERE id = $1 AND ($2::bigint = 0 OR version = $2)", id, version)
 	if err != nil {
 		return err
 	}
 	if res.RowsAffected() == 0 {
-		return fmt.Errorf("id задачи не найден в БД")
+		return s.missingOrConflict(ctx, *id)
 	}
 	return nil
 }
+
+// missingOrConflict выясняет, почему запись не изменилась: задачи нет или у нее другая версия
+func (s *Storage) missingOrConflict(ctx context.Context, id any) error {
+	var exists bool
+	err := s.db.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM scheduler WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("версия задачи в БД изменилась: %w", domain.ErrVersion)
+	}
+	return fmt.Errorf("id задачи не найден в БД: %w", domain.ErrNotFound)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) CreateToken(ctx context.Context, token *domain.APIToken) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(ctx,
+		"INSERT INTO api_tokens (name, prefix, hash, scopes, created_at, expires_at) VALUES ($1,$2,$3,$4,$5,$6) RETURNING id",
+		token.Name, token.Prefix, token.Hash, scopesToStrings(token.Scopes), token.CreatedAt, token.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (s *Storage) FindTokenByHash(ctx context.Context, hash string) (*domain.APIToken, error) {
+	row := s.db.QueryRow(ctx,
+		"SELECT id, name, prefix, hash, scopes, created_at, expires_at, last_used_at, revoked_at FROM api_tokens WHERE hash = $1", hash)
+	token, err := scanToken(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *Storage) ListTokens(ctx context.Context) ([]*domain.APIToken, error) {
+	tokens := make([]*domain.APIToken, 0)
+	rows, err := s.db.Query(ctx,
+		"SELECT id, name, prefix, hash, scopes, created_at, expires_at, last_used_at, revoked_at FROM api_tokens ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *Storage) RevokeToken(ctx context.Context, id int64) error {
+	res, err := s.db.Exec(ctx,
+		"UPDATE api_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return fmt.Errorf("id токена не найден в БД: %w", domain.ErrTokenNotFound)
+	}
+	return nil
+}
+
+func (s *Storage) TouchToken(ctx context.Context, id int64, usedAt time.Time) error {
+	_, err := s.db.Exec(ctx, "UPDATE api_tokens SET last_used_at = $1 WHERE id = $2", usedAt, id)
+	return err
+}
+
+func scanToken(row pgx.Row) (*domain.APIToken, error) {
+	var t domain.APIToken
+	var scopes []string
+	err := row.Scan(&t.ID, &t.Name, &t.Prefix, &t.Hash, &scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		t.Scopes = append(t.Scopes, domain.Scope(scope))
+	}
+	return &t, nil
+}
+
+func scopesToStrings(scopes []domain.Scope) []string {
+	res := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		res = append(res, string(scope))
+	}
+	return res
+}
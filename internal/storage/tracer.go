@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/agidelle/TODO_web_v2/internal/logging"
+	"github.com/jackc/pgx/v5"
+)
+
+// queryTracer пишет запросы к БД в логгер запроса из контекста, чтобы ошибки
+// базы связывались с HTTP-запросом: ошибки - с уровнем warn, остальные
+// запросы - с уровнем debug
+type queryTracer struct{}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql string
+	at  time.Time
+}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now()})
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, _ := ctx.Value(queryStartKey{}).(queryStart)
+	logger := logging.FromContext(ctx)
+	attrs := []slog.Attr{
+		slog.String("sql", start.sql),
+		slog.Duration("duration", time.Since(start.at)),
+	}
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		logger.LogAttrs(ctx, slog.LevelWarn, "Database query failed", append(attrs, slog.Any("error", data.Err))...)
+		return
+	}
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.LogAttrs(ctx, slog.LevelDebug, "Database query", append(attrs, slog.Int64("rows", data.CommandTag.RowsAffected()))...)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/agidelle/TODO_web_v2/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) GetTwoFactor(ctx context.Context, account string) (*domain.TwoFactor, error) {
+	var tf domain.TwoFactor
+	err := s.db.QueryRow(ctx,
+		"SELECT account, secret, enabled, recovery_codes, last_step, created_at FROM two_factor WHERE account = $1", account).
+		Scan(&tf.Account, &tf.Secret, &tf.Enabled, &tf.RecoveryCodes, &tf.LastStep, &tf.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+func (s *Storage) SaveTwoFactor(ctx context.Context, tf *domain.TwoFactor) error {
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO two_factor (account, secret, enabled, recovery_codes, last_step, created_at) VALUES ($1,$2,$3,$4,$5,$6)
+		ON CONFLICT (account) DO UPDATE SET secret = $2, enabled = $3, recovery_codes = $4, last_step = $5, created_at = $6`,
+		tf.Account, tf.Secret, tf.Enabled, tf.RecoveryCodes, tf.LastStep, tf.CreatedAt)
+	return err
+}
+
+// AdvanceTOTPStep сравнивает и меняет last_step одним запросом, поэтому
+// из двух одновременных входов с одним кодом проходит только один
+func (s *Storage) AdvanceTOTPStep(ctx context.Context, account string, step int64) (bool, error) {
+	res, err := s.db.Exec(ctx,
+		"UPDATE two_factor SET last_step = $2 WHERE account = $1 AND last_step < $2", account, step)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, account, hash string) (bool, error) {
+	res, err := s.db.Exec(ctx,
+		`UPDATE two_factor SET recovery_codes = array_remove(recovery_codes, $2)
+		WHERE account = $1 AND $2 = ANY(recovery_codes)`, account, hash)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (s *Storage) DeleteTwoFactor(ctx context.Context, account string) error {
+	_, err := s.db.Exec(ctx, "DELETE FROM two_factor WHERE account = $1", account)
+	return err
+}
@@ -4,7 +4,7 @@ Copyright © 2025 Agidelle
 */
 package main
 
-import "github.com/agidelle/merch-shop/cmd"
+import "github.com/agidelle/TODO_web_v2/cmd"
 
 func main() {
 	cmd.Execute()
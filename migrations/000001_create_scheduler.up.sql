@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS scheduler (
+    id      SERIAL PRIMARY KEY,
+    date    CHAR(8)      NOT NULL DEFAULT '',
+    title   VARCHAR(255) NOT NULL DEFAULT '',
+    comment TEXT         NOT NULL DEFAULT '',
+    repeat  VARCHAR(128) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS scheduler_date ON scheduler (date);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           BIGSERIAL PRIMARY KEY,
+    name         VARCHAR(128) NOT NULL,
+    prefix       VARCHAR(16)  NOT NULL,
+    hash         CHAR(64)     NOT NULL UNIQUE,
+    scopes       TEXT[]       NOT NULL DEFAULT '{read}',
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
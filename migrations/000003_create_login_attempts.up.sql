@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS login_state (
+    key          VARCHAR(255) PRIMARY KEY,
+    failures     INTEGER     NOT NULL DEFAULT 0,
+    last_failure TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id      BIGSERIAL PRIMARY KEY,
+    account VARCHAR(255) NOT NULL,
+    ip      VARCHAR(64)  NOT NULL,
+    success BOOLEAN      NOT NULL,
+    at      TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_at ON login_attempts (at);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS two_factor (
+    account        VARCHAR(255) PRIMARY KEY,
+    secret         VARCHAR(64) NOT NULL,
+    enabled        BOOLEAN     NOT NULL DEFAULT false,
+    recovery_codes TEXT[]      NOT NULL DEFAULT '{}',
+    last_step      BIGINT      NOT NULL DEFAULT 0,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS scheduler_comment_trgm;
+DROP INDEX IF EXISTS scheduler_title_trgm;
+DROP INDEX IF EXISTS scheduler_search;
+ALTER TABLE scheduler DROP COLUMN IF EXISTS search;
+DROP TEXT SEARCH CONFIGURATION IF EXISTS todo_search;
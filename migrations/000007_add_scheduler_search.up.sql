@@ -0,0 +1,23 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Русские слова стеммятся russian_stem, латинские - english_stem
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'todo_search') THEN
+        CREATE TEXT SEARCH CONFIGURATION todo_search (COPY = simple);
+        ALTER TEXT SEARCH CONFIGURATION todo_search
+            ALTER MAPPING FOR word, hword, hword_part WITH russian_stem;
+        ALTER TEXT SEARCH CONFIGURATION todo_search
+            ALTER MAPPING FOR asciiword, asciihword, hword_asciipart WITH english_stem;
+    END IF;
+END
+$$;
+
+ALTER TABLE scheduler ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('todo_search', title), 'A') ||
+    setweight(to_tsvector('todo_search', comment), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS scheduler_search ON scheduler USING GIN (search);
+CREATE INDEX IF NOT EXISTS scheduler_title_trgm ON scheduler USING GIN (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS scheduler_comment_trgm ON scheduler USING GIN (comment gin_trgm_ops);
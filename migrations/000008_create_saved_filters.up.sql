@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS saved_filters (
+    id         BIGSERIAL PRIMARY KEY,
+    name       VARCHAR(128) NOT NULL UNIQUE,
+    filter     JSONB        NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ  NOT NULL DEFAULT now()
+);
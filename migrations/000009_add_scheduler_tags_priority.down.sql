@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS scheduler_tags;
+ALTER TABLE scheduler DROP COLUMN IF EXISTS priority;
+ALTER TABLE scheduler DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,5 @@
+ALTER TABLE scheduler ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE scheduler ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0
+    CHECK (priority BETWEEN 0 AND 3);
+
+CREATE INDEX IF NOT EXISTS scheduler_tags ON scheduler USING GIN (tags);
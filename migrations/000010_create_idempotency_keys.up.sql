@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key          VARCHAR(320) PRIMARY KEY,
+    request_hash CHAR(64)     NOT NULL,
+    completed    BOOLEAN      NOT NULL DEFAULT false,
+    status       INTEGER      NOT NULL DEFAULT 0,
+    header       JSONB        NOT NULL DEFAULT '{}',
+    body         BYTEA,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at ON idempotency_keys (expires_at);